@@ -7,6 +7,7 @@ import (
 	"os"
 
 	"github.com/Biz0n58/Zaria/backend/config"
+	"github.com/Biz0n58/Zaria/backend/passwords"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -24,20 +25,39 @@ func main() {
 	}
 	defer db.Close()
 
-	email := "admin@zaria.com"
-	password := "admin123"
+	email := getEnv("SEED_ADMIN_EMAIL", "admin@zaria.com")
+	password := os.Getenv("SEED_ADMIN_PASSWORD")
+
+	var existingID string
+	err = db.QueryRow(context.Background(), "SELECT id FROM admins WHERE LOWER(email) = LOWER($1)", email).Scan(&existingID)
+	if err == nil && password == "" {
+		log.Printf("Admin with email %s already exists, nothing to do", email)
+		return
+	}
+
+	// Without an explicit password a random one is generated and the admin
+	// has to replace it on first login. It is only shown on a terminal so
+	// that it never ends up in deployment logs.
+	resetRequired := false
+	if password == "" {
+		if !isTerminal(os.Stdout) {
+			log.Fatal("SEED_ADMIN_PASSWORD is required when stdout is not a terminal")
+		}
+		password, err = passwords.Temporary()
+		if err != nil {
+			log.Fatal("Failed to generate password:", err)
+		}
+		resetRequired = true
+	}
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		log.Fatal("Failed to hash password:", err)
 	}
 
-	var existingID string
-	err = db.QueryRow(context.Background(), "SELECT id FROM admins WHERE email = $1", email).Scan(&existingID)
-	if err == nil {
+	if existingID != "" {
 		log.Printf("Admin with email %s already exists, updating password...", email)
-		_, err = db.Exec(context.Background(), "UPDATE admins SET password_hash = $1 WHERE email = $2", hashedPassword, email)
-		if err != nil {
+		if err := resetAdminPassword(context.Background(), db, existingID, hashedPassword); err != nil {
 			log.Fatal("Failed to update admin:", err)
 		}
 		log.Println("Admin password updated successfully")
@@ -46,14 +66,65 @@ func main() {
 
 	_, err = db.Exec(
 		context.Background(),
-		"INSERT INTO admins (email, password_hash) VALUES ($1, $2) ON CONFLICT (email) DO UPDATE SET password_hash = $2",
-		email, hashedPassword,
+		"INSERT INTO admins (email, password_hash, role, password_reset_required) VALUES ($1, $2, 'owner', $3)",
+		email, hashedPassword, resetRequired,
 	)
 	if err != nil {
 		log.Fatal("Failed to create admin:", err)
 	}
 
-	log.Printf("Admin created successfully: %s / %s", email, password)
+	log.Printf("Admin created successfully: %s", email)
+	if resetRequired {
+		fmt.Printf("One-time password: %s (change it after first login)\n", password)
+	}
+}
+
+// resetAdminPassword sets a new password the way a password reset does:
+// the lockout is lifted and every session of the admin is signed out.
+func resetAdminPassword(ctx context.Context, db *pgxpool.Pool, adminID string, hash []byte) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(
+		ctx,
+		`UPDATE admins SET password_hash = $1, password_reset_required = false,
+		   failed_login_count = 0, locked_until = NULL, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $2`,
+		hash, adminID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		`DELETE FROM login_attempts
+		 WHERE scope = 'email' AND key = (SELECT LOWER(email) FROM admins WHERE id = $1)`,
+		adminID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		`UPDATE admin_sessions SET revoked_at = CURRENT_TIMESTAMP
+		 WHERE admin_id = $1 AND revoked_at IS NULL`,
+		adminID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
 }
 
 func getEnv(key, defaultValue string) string {
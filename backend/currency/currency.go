@@ -0,0 +1,134 @@
+// Package currency handles currency codes, minor units and conversion
+// between currencies with admin-managed exchange rates.
+//
+// Amounts throughout the store are integers in the minor unit of their
+// currency ("cents"): cents for USD, whole yen for JPY, fils for KWD.
+package currency
+
+import (
+	"math"
+	"regexp"
+	"strings"
+)
+
+var codePattern = regexp.MustCompile(`^[a-z]{3}$`)
+
+// zeroDecimal and threeDecimal list the currencies whose minor unit is not
+// a hundredth of the major unit.
+var (
+	zeroDecimal = map[string]bool{
+		"bif": true, "clp": true, "djf": true, "gnf": true, "isk": true, "jpy": true,
+		"kmf": true, "krw": true, "mga": true, "pyg": true, "rwf": true, "ugx": true,
+		"vnd": true, "vuv": true, "xaf": true, "xof": true, "xpf": true,
+	}
+	threeDecimal = map[string]bool{
+		"bhd": true, "jod": true, "kwd": true, "omr": true, "tnd": true,
+	}
+)
+
+// Normalize returns the lower-case code Stripe and the database use.
+func Normalize(code string) string {
+	return strings.ToLower(strings.TrimSpace(code))
+}
+
+// Valid reports whether code looks like an ISO 4217 code.
+func Valid(code string) bool {
+	return codePattern.MatchString(code)
+}
+
+// Exponent returns the number of decimal places of the currency's minor
+// unit.
+func Exponent(code string) int {
+	switch {
+	case zeroDecimal[code]:
+		return 0
+	case threeDecimal[code]:
+		return 3
+	default:
+		return 2
+	}
+}
+
+// Rates converts between currencies. Each rate is the number of units of a
+// currency that one unit of Base buys, e.g. {"eur": 0.92} for a USD base.
+type Rates struct {
+	Base  string
+	Rates map[string]float64
+}
+
+// Supports reports whether amounts can be converted to and from code.
+func (r Rates) Supports(code string) bool {
+	_, ok := r.rate(code)
+	return ok
+}
+
+func (r Rates) rate(code string) (float64, bool) {
+	if code == r.Base {
+		return 1, true
+	}
+	rate, ok := r.Rates[code]
+	return rate, ok && rate > 0
+}
+
+// Convert converts an amount in the minor unit of from into the minor unit
+// of to, rounding to the nearest unit. ok is false when either currency has
+// no rate.
+func (r Rates) Convert(amount int, from, to string) (int, bool) {
+	if from == to {
+		return amount, true
+	}
+	fromRate, ok := r.rate(from)
+	if !ok {
+		return 0, false
+	}
+	toRate, ok := r.rate(to)
+	if !ok {
+		return 0, false
+	}
+
+	major := float64(amount) / math.Pow10(Exponent(from))
+	converted := major / fromRate * toRate
+	return int(math.Round(converted * math.Pow10(Exponent(to)))), true
+}
+
+// Factor returns the number amounts in the minor unit of from are
+// multiplied by to get amounts in the minor unit of to, so that prices can
+// be converted inside SQL queries. ok is false when either currency has no
+// rate.
+func (r Rates) Factor(from, to string) (float64, bool) {
+	if from == to {
+		return 1, true
+	}
+	fromRate, ok := r.rate(from)
+	if !ok {
+		return 0, false
+	}
+	toRate, ok := r.rate(to)
+	if !ok {
+		return 0, false
+	}
+	return toRate / fromRate * math.Pow10(Exponent(to)-Exponent(from)), true
+}
+
+// Chargeable rounds amount, in the minor unit of code, to an amount that
+// can be charged: three-decimal currencies are charged in multiples of ten.
+// Totals are rounded with it before they are stored, so the stored total is
+// what the customer pays.
+func Chargeable(amount int, code string) int {
+	if threeDecimal[code] {
+		return int(math.Round(float64(amount)/10) * 10)
+	}
+	return amount
+}
+
+// StripeAmount returns a chargeable amount, in the minor unit of code, as
+// Stripe expects it. Stripe takes ISK and UGX with two (zero) decimals
+// although they have none.
+func StripeAmount(amount int, code string) int64 {
+	switch {
+	case code == "isk" || code == "ugx":
+		return int64(amount) * 100
+	default:
+		return int64(Chargeable(amount, code))
+	}
+}
@@ -0,0 +1,47 @@
+package currency
+
+import "testing"
+
+func TestChargeable(t *testing.T) {
+	tests := []struct {
+		amount int
+		code   string
+		want   int
+	}{
+		{1234, "usd", 1234},
+		{1234, "jpy", 1234},
+		{1234, "kwd", 1230},
+		{1235, "kwd", 1240},
+		{1236, "bhd", 1240},
+		{1240, "omr", 1240},
+		{4, "jod", 0},
+		{5, "tnd", 10},
+		{0, "kwd", 0},
+	}
+	for _, tt := range tests {
+		if got := Chargeable(tt.amount, tt.code); got != tt.want {
+			t.Errorf("Chargeable(%d, %q) = %d, want %d", tt.amount, tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestStripeAmount(t *testing.T) {
+	tests := []struct {
+		amount int
+		code   string
+		want   int64
+	}{
+		{1999, "usd", 1999},
+		{1999, "eur", 1999},
+		{500, "jpy", 500},
+		{500, "isk", 50000},
+		{500, "ugx", 50000},
+		{1235, "kwd", 1240},
+		{1230, "kwd", 1230},
+	}
+	for _, tt := range tests {
+		if got := StripeAmount(tt.amount, tt.code); got != tt.want {
+			t.Errorf("StripeAmount(%d, %q) = %d, want %d", tt.amount, tt.code, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/Biz0n58/Zaria/backend/mailer"
+	"github.com/Biz0n58/Zaria/backend/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type PasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+type PasswordResetConfirmRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// passwordResetRequested is returned whether or not the email belongs to an
+// account so that the endpoint cannot be used to discover accounts.
+const passwordResetRequested = "if an account exists for this email, a reset link has been sent"
+
+func passwordResetMessage(to, link string) mailer.Message {
+	return mailer.Message{
+		To:      to,
+		Subject: "Reset your Zaria password",
+		Body: "Someone asked to reset the password for this account.\n\n" +
+			"Open the link below within the next hour to choose a new password:\n\n" +
+			link + "\n\n" +
+			"If you did not ask for this, you can ignore this email.\n",
+	}
+}
+
+func (h *AdminHandler) RequestPasswordReset(c *fiber.Ctx) error {
+	var req PasswordResetRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if email == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "email is required"})
+	}
+
+	var adminID uuid.UUID
+	var adminEmail string
+	err := h.DB.QueryRow(
+		c.Context(),
+		`SELECT id, email FROM admins WHERE LOWER(email) = $1 AND disabled_at IS NULL`,
+		email,
+	).Scan(&adminID, &adminEmail)
+	if err != nil {
+		return c.JSON(fiber.Map{"message": passwordResetRequested})
+	}
+
+	token, err := issueAccountToken(c.Context(), h.DB, tokenPurposePasswordReset, accountRef{AdminID: &adminID}, passwordResetTTL)
+	if errors.Is(err, errAccountTokenCooldown) {
+		return c.JSON(fiber.Map{"message": passwordResetRequested})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to create reset token"})
+	}
+
+	sendMailAsync(h.Mailer, passwordResetMessage(adminEmail, appURL("/admin/reset-password", token)))
+
+	return c.JSON(fiber.Map{"message": passwordResetRequested})
+}
+
+// ConfirmPasswordReset sets a new password, clears any lockout and signs the
+// admin out everywhere. Two-factor authentication stays enabled.
+func (h *AdminHandler) ConfirmPasswordReset(c *fiber.Ctx) error {
+	var req PasswordResetConfirmRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+	if req.Token == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "token is required"})
+	}
+	if len(req.NewPassword) < minPasswordLength {
+		return c.Status(400).JSON(fiber.Map{"error": "new_password must be at least 8 characters"})
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to hash password"})
+	}
+
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+	}
+	defer tx.Rollback(c.Context())
+
+	ref, err := consumeAccountToken(c.Context(), tx, tokenPurposePasswordReset, req.Token)
+	if isInvalidAccountToken(err) || (err == nil && ref.AdminID == nil) {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid or expired token"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to reset password"})
+	}
+
+	var email string
+	err = tx.QueryRow(
+		c.Context(),
+		`UPDATE admins SET password_hash = $1, password_reset_required = false, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $2 AND disabled_at IS NULL
+		 RETURNING LOWER(email)`,
+		string(hash), *ref.AdminID,
+	).Scan(&email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid or expired token"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to reset password"})
+	}
+
+	if err := resetLoginFailures(c.Context(), tx, adminLoginScopes, email, ref.AdminID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to reset password"})
+	}
+
+	if err := revokeAdminSessions(c.Context(), tx, *ref.AdminID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to revoke sessions"})
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+	}
+
+	return c.JSON(fiber.Map{"message": "password updated"})
+}
+
+func (h *CustomerHandler) RequestPasswordReset(c *fiber.Ctx) error {
+	var req PasswordResetRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if email == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "email is required"})
+	}
+
+	var customerID uuid.UUID
+	err := h.DB.QueryRow(c.Context(), `SELECT id FROM customers WHERE email = $1`, email).Scan(&customerID)
+	if err != nil {
+		return c.JSON(fiber.Map{"message": passwordResetRequested})
+	}
+
+	token, err := issueAccountToken(c.Context(), h.DB, tokenPurposePasswordReset, accountRef{CustomerID: &customerID}, passwordResetTTL)
+	if errors.Is(err, errAccountTokenCooldown) {
+		return c.JSON(fiber.Map{"message": passwordResetRequested})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to create reset token"})
+	}
+
+	sendMailAsync(h.Mailer, passwordResetMessage(email, appURL("/reset-password", token)))
+
+	return c.JSON(fiber.Map{"message": passwordResetRequested})
+}
+
+// ConfirmPasswordReset also marks the email as verified, since following the
+// link proves the customer controls the inbox.
+func (h *CustomerHandler) ConfirmPasswordReset(c *fiber.Ctx) error {
+	var req PasswordResetConfirmRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+	if req.Token == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "token is required"})
+	}
+	if len(req.NewPassword) < minPasswordLength {
+		return c.Status(400).JSON(fiber.Map{"error": "new_password must be at least 8 characters"})
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to hash password"})
+	}
+
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+	}
+	defer tx.Rollback(c.Context())
+
+	ref, err := consumeAccountToken(c.Context(), tx, tokenPurposePasswordReset, req.Token)
+	if isInvalidAccountToken(err) || (err == nil && ref.CustomerID == nil) {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid or expired token"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to reset password"})
+	}
+
+	// Bumping the token version signs out every existing session, including
+	// one opened with a stolen token.
+	var email string
+	err = tx.QueryRow(
+		c.Context(),
+		`UPDATE customers SET password_hash = $1,
+		   email_verified_at = COALESCE(email_verified_at, CURRENT_TIMESTAMP),
+		   token_version = token_version + 1,
+		   updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $2
+		 RETURNING email`,
+		string(hash), *ref.CustomerID,
+	).Scan(&email)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to reset password"})
+	}
+
+	// Lift any login backoff that the forgotten password caused.
+	if err := resetLoginFailures(c.Context(), tx, customerLoginScopes, email, nil); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to reset password"})
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+	}
+
+	return c.JSON(fiber.Map{"message": "password updated"})
+}
+
+func (h *CustomerHandler) VerifyEmail(c *fiber.Ctx) error {
+	var req VerifyEmailRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+	if req.Token == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "token is required"})
+	}
+
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+	}
+	defer tx.Rollback(c.Context())
+
+	ref, err := consumeAccountToken(c.Context(), tx, tokenPurposeEmailVerification, req.Token)
+	if isInvalidAccountToken(err) || (err == nil && ref.CustomerID == nil) {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid or expired token"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to verify email"})
+	}
+
+	var customer models.Customer
+	err = scanCustomer(tx.QueryRow(
+		c.Context(),
+		`UPDATE customers SET email_verified_at = COALESCE(email_verified_at, CURRENT_TIMESTAMP), updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $1 RETURNING `+customerColumns,
+		*ref.CustomerID,
+	), &customer)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to verify email"})
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+	}
+
+	return c.JSON(customer)
+}
+
+func (h *CustomerHandler) ResendVerificationEmail(c *fiber.Ctx) error {
+	customerUUID, err := currentCustomerID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	var customer models.Customer
+	err = scanCustomer(h.DB.QueryRow(
+		c.Context(),
+		`SELECT `+customerColumns+` FROM customers WHERE id = $1`,
+		customerUUID,
+	), &customer)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "account not found"})
+	}
+	if customer.EmailVerifiedAt != nil {
+		return c.Status(409).JSON(fiber.Map{"error": "email already verified"})
+	}
+
+	err = h.sendVerificationEmail(c.Context(), customer)
+	if errors.Is(err, errAccountTokenCooldown) {
+		return c.Status(429).JSON(fiber.Map{"error": "a verification email was sent recently, try again later"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to send verification email"})
+	}
+
+	return c.JSON(fiber.Map{"message": "verification email sent"})
+}
+
+func (h *CustomerHandler) sendVerificationEmail(ctx context.Context, customer models.Customer) error {
+	token, err := issueAccountToken(ctx, h.DB, tokenPurposeEmailVerification, accountRef{CustomerID: &customer.ID}, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	sendMailAsync(h.Mailer, mailer.Message{
+		To:      customer.Email,
+		Subject: "Confirm your email address",
+		Body: "Welcome to Zaria!\n\n" +
+			"Please confirm your email address by opening this link:\n\n" +
+			appURL("/verify-email", token) + "\n",
+	})
+	return nil
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Biz0n58/Zaria/backend/mailer"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	tokenPurposePasswordReset     = "password_reset"
+	tokenPurposeEmailVerification = "email_verification"
+
+	passwordResetTTL     = time.Hour
+	emailVerificationTTL = 48 * time.Hour
+
+	// A new token is not issued (and no email sent) while one for the same
+	// account and purpose is younger than this.
+	accountTokenCooldown = time.Minute
+
+	mailSendTimeout = 30 * time.Second
+)
+
+var errAccountTokenCooldown = errors.New("account token requested too recently")
+
+// accountRef identifies the owner of an account token; exactly one of the
+// ids is set.
+type accountRef struct {
+	AdminID    *uuid.UUID
+	CustomerID *uuid.UUID
+}
+
+// issueAccountToken invalidates earlier unused tokens of the same purpose for
+// the account and returns a new one. It returns errAccountTokenCooldown when
+// the previous token was issued less than accountTokenCooldown ago.
+func issueAccountToken(ctx context.Context, db querier, purpose string, ref accountRef, ttl time.Duration) (string, error) {
+	var recent bool
+	err := db.QueryRow(
+		ctx,
+		`SELECT EXISTS (
+		   SELECT 1 FROM account_tokens
+		   WHERE purpose = $1 AND admin_id IS NOT DISTINCT FROM $2 AND customer_id IS NOT DISTINCT FROM $3
+		     AND created_at > CURRENT_TIMESTAMP - make_interval(secs => $4)
+		 )`,
+		purpose, ref.AdminID, ref.CustomerID, accountTokenCooldown.Seconds(),
+	).Scan(&recent)
+	if err != nil {
+		return "", err
+	}
+	if recent {
+		return "", errAccountTokenCooldown
+	}
+
+	_, err = db.Exec(
+		ctx,
+		`UPDATE account_tokens SET used_at = CURRENT_TIMESTAMP
+		 WHERE purpose = $1 AND admin_id IS NOT DISTINCT FROM $2 AND customer_id IS NOT DISTINCT FROM $3
+		   AND used_at IS NULL`,
+		purpose, ref.AdminID, ref.CustomerID,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	token, hash, err := generateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = db.Exec(
+		ctx,
+		`INSERT INTO account_tokens (token_hash, purpose, admin_id, customer_id, expires_at)
+		 VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP + make_interval(secs => $5))`,
+		hash, purpose, ref.AdminID, ref.CustomerID, ttl.Seconds(),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// consumeAccountToken marks a valid token as used and returns its owner. An
+// unknown, expired or already used token yields pgx.ErrNoRows.
+func consumeAccountToken(ctx context.Context, db querier, purpose, token string) (accountRef, error) {
+	var ref accountRef
+	err := db.QueryRow(
+		ctx,
+		`UPDATE account_tokens SET used_at = CURRENT_TIMESTAMP
+		 WHERE token_hash = $1 AND purpose = $2
+		   AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		 RETURNING admin_id, customer_id`,
+		hashToken(strings.TrimSpace(token)), purpose,
+	).Scan(&ref.AdminID, &ref.CustomerID)
+	return ref, err
+}
+
+func isInvalidAccountToken(err error) bool {
+	return errors.Is(err, pgx.ErrNoRows)
+}
+
+// appURL builds a link into the web app, which is expected to read the token
+// from the query string and post it back to the API.
+func appURL(path, token string) string {
+	base := os.Getenv("APP_BASE_URL")
+	if base == "" {
+		base = "http://localhost:3000"
+	}
+	return strings.TrimRight(base, "/") + path + "?token=" + token
+}
+
+// sendMailAsync delivers msg in the background so that response times do not
+// reveal whether an account exists, and so a slow SMTP server does not hold
+// up the request. Failures are only logged.
+func sendMailAsync(m mailer.Mailer, msg mailer.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailSendTimeout)
+		defer cancel()
+		if err := m.Send(ctx, msg); err != nil {
+			log.Println("mailer: failed to send to", msg.To+":", err)
+		}
+	}()
+}
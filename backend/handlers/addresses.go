@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Biz0n58/Zaria/backend/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+type addressRule struct {
+	RegionRequired bool
+	// NoPostalCode is set for countries that do not use postal codes.
+	NoPostalCode bool
+	// PostalCode, when set, is the expected format after upper-casing.
+	PostalCode *regexp.Regexp
+}
+
+// addressRules holds the countries that need more than the default of name,
+// line1, city and a free-form postal code.
+var addressRules = map[string]addressRule{
+	"US": {RegionRequired: true, PostalCode: regexp.MustCompile(`^\d{5}(-\d{4})?$`)},
+	"CA": {RegionRequired: true, PostalCode: regexp.MustCompile(`^[A-Z]\d[A-Z] ?\d[A-Z]\d$`)},
+	"AU": {RegionRequired: true, PostalCode: regexp.MustCompile(`^\d{4}$`)},
+	"GB": {PostalCode: regexp.MustCompile(`^[A-Z]{1,2}\d[A-Z\d]? ?\d[A-Z]{2}$`)},
+	"DE": {PostalCode: regexp.MustCompile(`^\d{5}$`)},
+	"FR": {PostalCode: regexp.MustCompile(`^\d{5}$`)},
+	"NL": {PostalCode: regexp.MustCompile(`^\d{4} ?[A-Z]{2}$`)},
+	"AE": {NoPostalCode: true},
+	"HK": {NoPostalCode: true},
+	"QA": {NoPostalCode: true},
+}
+
+var countryCodePattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// addressFieldLimits are the column sizes of address tables, in characters.
+var addressFieldLimits = []struct {
+	name  string
+	value func(a *models.Address) string
+	max   int
+}{
+	{"name", func(a *models.Address) string { return a.Name }, 255},
+	{"line1", func(a *models.Address) string { return a.Line1 }, 255},
+	{"line2", func(a *models.Address) string { return a.Line2 }, 255},
+	{"city", func(a *models.Address) string { return a.City }, 100},
+	{"region", func(a *models.Address) string { return a.Region }, 100},
+	{"postal_code", func(a *models.Address) string { return a.PostalCode }, 20},
+	{"phone", func(a *models.Address) string { return a.Phone }, 50},
+}
+
+// normalizeAddress trims every field and upper-cases the country and postal
+// code so they can be validated and stored consistently.
+func normalizeAddress(a *models.Address) {
+	a.Name = strings.TrimSpace(a.Name)
+	a.Line1 = strings.TrimSpace(a.Line1)
+	a.Line2 = strings.TrimSpace(a.Line2)
+	a.City = strings.TrimSpace(a.City)
+	a.Region = strings.TrimSpace(a.Region)
+	a.PostalCode = strings.ToUpper(strings.TrimSpace(a.PostalCode))
+	a.Country = strings.ToUpper(strings.TrimSpace(a.Country))
+	a.Phone = strings.TrimSpace(a.Phone)
+}
+
+// validateAddress normalizes a and returns a message describing the first
+// problem found, or "" when the address is complete for its country.
+func validateAddress(a *models.Address) string {
+	normalizeAddress(a)
+
+	if !countryCodePattern.MatchString(a.Country) {
+		return "country must be a two-letter ISO code"
+	}
+	if a.Name == "" {
+		return "name is required"
+	}
+	if a.Line1 == "" {
+		return "line1 is required"
+	}
+	if a.City == "" {
+		return "city is required"
+	}
+	for _, f := range addressFieldLimits {
+		if utf8.RuneCountInString(f.value(a)) > f.max {
+			return f.name + " must be at most " + strconv.Itoa(f.max) + " characters"
+		}
+	}
+
+	rule := addressRules[a.Country]
+	if rule.RegionRequired && a.Region == "" {
+		return "region is required for " + a.Country
+	}
+	region, ok := normalizeRegion(a.Country, a.Region)
+	if !ok {
+		return "region is not a valid region of " + a.Country
+	}
+	a.Region = region
+	if rule.NoPostalCode {
+		return ""
+	}
+	if a.PostalCode == "" {
+		return "postal_code is required for " + a.Country
+	}
+	if rule.PostalCode != nil && !rule.PostalCode.MatchString(a.PostalCode) {
+		return "postal_code is not valid for " + a.Country
+	}
+
+	return ""
+}
+
+const orderAddressColumns = `id, order_id, type, name, line1, line2, city, region, postal_code, country, phone, created_at`
+
+func scanOrderAddress(row pgx.Row, a *models.OrderAddress) error {
+	return row.Scan(
+		&a.ID, &a.OrderID, &a.Type, &a.Name, &a.Line1, &a.Line2, &a.City,
+		&a.Region, &a.PostalCode, &a.Country, &a.Phone, &a.CreatedAt,
+	)
+}
+
+func insertOrderAddress(ctx context.Context, db querier, orderID uuid.UUID, addressType string, a models.Address) error {
+	_, err := db.Exec(
+		ctx,
+		`INSERT INTO order_addresses (order_id, type, name, line1, line2, city, region, postal_code, country, phone)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		orderID, addressType, a.Name, a.Line1, a.Line2, a.City, a.Region, a.PostalCode, a.Country, a.Phone,
+	)
+	return err
+}
+
+// loadOrderAddresses fills in the shipping and billing snapshots of order.
+// Orders placed before addresses were collected have neither.
+func loadOrderAddresses(ctx context.Context, db querier, order *models.Order) error {
+	rows, err := db.Query(
+		ctx,
+		`SELECT `+orderAddressColumns+` FROM order_addresses WHERE order_id = $1`,
+		order.ID,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a models.OrderAddress
+		if err := scanOrderAddress(rows, &a); err != nil {
+			return err
+		}
+		switch a.Type {
+		case models.AddressTypeShipping:
+			order.ShippingAddress = &a
+		case models.AddressTypeBilling:
+			order.BillingAddress = &a
+		}
+	}
+
+	return rows.Err()
+}
+
+const customerAddressColumns = `id, customer_id, label, name, line1, line2, city, region, postal_code, country, phone, is_default, created_at, updated_at`
+
+func scanCustomerAddress(row pgx.Row, a *models.CustomerAddress) error {
+	return row.Scan(
+		&a.ID, &a.CustomerID, &a.Label, &a.Name, &a.Line1, &a.Line2, &a.City,
+		&a.Region, &a.PostalCode, &a.Country, &a.Phone, &a.IsDefault, &a.CreatedAt, &a.UpdatedAt,
+	)
+}
+
+var errAddressNotFound = errors.New("address not found")
+
+// loadCustomerAddress returns a saved address of the customer, or
+// errAddressNotFound when it does not exist or belongs to someone else.
+func loadCustomerAddress(ctx context.Context, db querier, customerID, addressID uuid.UUID) (models.Address, error) {
+	var a models.CustomerAddress
+	err := scanCustomerAddress(db.QueryRow(
+		ctx,
+		`SELECT `+customerAddressColumns+` FROM customer_addresses WHERE id = $1 AND customer_id = $2`,
+		addressID, customerID,
+	), &a)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Address{}, errAddressNotFound
+	}
+	return a.Address, err
+}
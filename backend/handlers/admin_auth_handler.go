@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Biz0n58/Zaria/backend/middleware"
+	"github.com/Biz0n58/Zaria/backend/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// dummyPasswordHash is compared against when the email is unknown so that a
+// failed login takes the same time whether or not the admin exists.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("zaria-dummy-password"), bcrypt.DefaultCost)
+
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type AuthTokens struct {
+	Token            string    `json:"token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// MFAChallengeResponse is returned by Login instead of tokens when the admin
+// has two-factor authentication enabled.
+type MFAChallengeResponse struct {
+	MFARequired    bool      `json:"mfa_required"`
+	ChallengeToken string    `json:"challenge_token"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+type LoginResponse struct {
+	AuthTokens
+	Admin       models.Admin `json:"admin"`
+	Permissions []string     `json:"permissions"`
+}
+
+func (h *AdminHandler) Login(c *fiber.Ctx) error {
+	var req LoginRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if email == "" || req.Password == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "email and password are required"})
+	}
+
+	retryAfter, err := loginRetryAfter(c.Context(), h.DB, adminLoginScopes, c.IP(), email)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to check login attempts"})
+	}
+	if retryAfter > 0 {
+		return tooManyAttempts(c, retryAfter)
+	}
+
+	var admin models.Admin
+	err = scanAdmin(h.DB.QueryRow(
+		c.Context(),
+		`SELECT `+adminColumns+` FROM admins WHERE LOWER(email) = $1`,
+		email,
+	), &admin)
+	if err != nil {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(req.Password))
+		_ = recordLoginFailure(c.Context(), h.DB, adminLoginScopes, c.IP(), email, nil)
+		return c.Status(401).JSON(fiber.Map{"error": "invalid email or password"})
+	}
+
+	lockedFor, err := adminLockedFor(c.Context(), h.DB, admin.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to check login attempts"})
+	}
+	if lockedFor > 0 {
+		return tooManyAttempts(c, lockedFor)
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(admin.PasswordHash), []byte(req.Password)); err != nil {
+		_ = recordLoginFailure(c.Context(), h.DB, adminLoginScopes, c.IP(), email, &admin.ID)
+		return c.Status(401).JSON(fiber.Map{"error": "invalid email or password"})
+	}
+
+	if admin.DisabledAt != nil {
+		return c.Status(403).JSON(fiber.Map{"error": "account disabled"})
+	}
+
+	if admin.TwoFactorEnabled {
+		challenge, expiresAt, err := middleware.GenerateMFAChallengeToken(admin.ID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to issue token"})
+		}
+		return c.JSON(MFAChallengeResponse{
+			MFARequired:    true,
+			ChallengeToken: challenge,
+			ExpiresAt:      expiresAt,
+		})
+	}
+
+	return h.completeLogin(c, admin)
+}
+
+func (h *AdminHandler) completeLogin(c *fiber.Ctx, admin models.Admin) error {
+	if err := resetLoginFailures(c.Context(), h.DB, adminLoginScopes, strings.ToLower(admin.Email), &admin.ID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to reset login attempts"})
+	}
+
+	tokens, err := issueAdminSession(c, h.DB, admin, uuid.New())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to issue token"})
+	}
+
+	return c.JSON(LoginResponse{
+		AuthTokens:  tokens,
+		Admin:       admin,
+		Permissions: middleware.RolePermissions(admin.Role),
+	})
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (h *AdminHandler) Refresh(c *fiber.Ctx) error {
+	var req RefreshRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+	if req.RefreshToken == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "refresh_token is required"})
+	}
+
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+	}
+	defer tx.Rollback(c.Context())
+
+	var session models.AdminSession
+	err = tx.QueryRow(
+		c.Context(),
+		`SELECT id, admin_id, family_id, expires_at, rotated_at, revoked_at
+		 FROM admin_sessions WHERE refresh_token_hash = $1 FOR UPDATE`,
+		hashToken(req.RefreshToken),
+	).Scan(
+		&session.ID, &session.AdminID, &session.FamilyID,
+		&session.ExpiresAt, &session.RotatedAt, &session.RevokedAt,
+	)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "invalid refresh token"})
+	}
+
+	if session.RevokedAt != nil || session.ExpiresAt.Before(time.Now()) {
+		return c.Status(401).JSON(fiber.Map{"error": "invalid refresh token"})
+	}
+
+	// A refresh token that was already rotated is being replayed, so the
+	// whole family is treated as compromised.
+	if session.RotatedAt != nil {
+		if err := revokeSessionFamily(c.Context(), tx, session.FamilyID); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to revoke session"})
+		}
+		if err := tx.Commit(c.Context()); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+		}
+		return c.Status(401).JSON(fiber.Map{"error": "invalid refresh token"})
+	}
+
+	var admin models.Admin
+	err = scanAdmin(tx.QueryRow(
+		c.Context(),
+		`SELECT `+adminColumns+` FROM admins WHERE id = $1`,
+		session.AdminID,
+	), &admin)
+	if err != nil || admin.DisabledAt != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "invalid refresh token"})
+	}
+
+	_, err = tx.Exec(
+		c.Context(),
+		`UPDATE admin_sessions SET rotated_at = CURRENT_TIMESTAMP WHERE id = $1`,
+		session.ID,
+	)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to rotate session"})
+	}
+
+	tokens, err := issueAdminSession(c, tx, admin, session.FamilyID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to issue token"})
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+	}
+
+	return c.JSON(tokens)
+}
+
+func (h *AdminHandler) Logout(c *fiber.Ctx) error {
+	var req RefreshRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+	if req.RefreshToken == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "refresh_token is required"})
+	}
+
+	var familyID uuid.UUID
+	err := h.DB.QueryRow(
+		c.Context(),
+		`SELECT family_id FROM admin_sessions WHERE refresh_token_hash = $1`,
+		hashToken(req.RefreshToken),
+	).Scan(&familyID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.JSON(fiber.Map{"message": "logged out"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "failed to load session"})
+	}
+
+	if err := revokeSessionFamily(c.Context(), h.DB, familyID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to revoke session"})
+	}
+
+	return c.JSON(fiber.Map{"message": "logged out"})
+}
+
+// issueAdminSession stores a new hashed refresh token in the given session
+// family and returns it together with a matching access token.
+func issueAdminSession(c *fiber.Ctx, db querier, admin models.Admin, familyID uuid.UUID) (AuthTokens, error) {
+	refreshToken, refreshHash, err := generateOpaqueToken()
+	if err != nil {
+		return AuthTokens{}, err
+	}
+
+	refreshExpiresAt := time.Now().Add(middleware.RefreshTokenTTL)
+	_, err = db.Exec(
+		c.Context(),
+		`INSERT INTO admin_sessions (admin_id, family_id, refresh_token_hash, user_agent, ip_address, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6)`,
+		admin.ID, familyID, refreshHash, c.Get(fiber.HeaderUserAgent), c.IP(), refreshExpiresAt,
+	)
+	if err != nil {
+		return AuthTokens{}, err
+	}
+
+	token, expiresAt, err := middleware.GenerateAdminToken(admin, familyID)
+	if err != nil {
+		return AuthTokens{}, err
+	}
+
+	return AuthTokens{
+		Token:            token,
+		ExpiresAt:        expiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: refreshExpiresAt,
+	}, nil
+}
+
+func revokeAdminSessions(ctx context.Context, db querier, adminID uuid.UUID) error {
+	_, err := db.Exec(
+		ctx,
+		`UPDATE admin_sessions SET revoked_at = CURRENT_TIMESTAMP
+		 WHERE admin_id = $1 AND revoked_at IS NULL`,
+		adminID,
+	)
+	return err
+}
+
+func revokeSessionFamily(ctx context.Context, db querier, familyID uuid.UUID) error {
+	_, err := db.Exec(
+		ctx,
+		`UPDATE admin_sessions SET revoked_at = CURRENT_TIMESTAMP
+		 WHERE family_id = $1 AND revoked_at IS NULL`,
+		familyID,
+	)
+	return err
+}
@@ -1,20 +1,26 @@
 package handlers
 
 import (
+	"errors"
 	"strconv"
 
+	"github.com/Biz0n58/Zaria/backend/inventory"
+	"github.com/Biz0n58/Zaria/backend/mailer"
+	"github.com/Biz0n58/Zaria/backend/middleware"
 	"github.com/Biz0n58/Zaria/backend/models"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type AdminHandler struct {
-	DB *pgxpool.Pool
+	DB     *pgxpool.Pool
+	Mailer mailer.Mailer
 }
 
-func NewAdminHandler(db *pgxpool.Pool) *AdminHandler {
-	return &AdminHandler{DB: db}
+func NewAdminHandler(db *pgxpool.Pool, m mailer.Mailer) *AdminHandler {
+	return &AdminHandler{DB: db, Mailer: m}
 }
 
 type OrdersResponse struct {
@@ -37,54 +43,10 @@ func (h *AdminHandler) GetOrders(c *fiber.Ctx) error {
 	}
 	offset := (page - 1) * limit
 
-	query := `SELECT id, customer_email, status, subtotal_cents, shipping_cents, total_cents, currency, created_at, updated_at 
-		 FROM orders WHERE 1=1`
-	args := []interface{}{}
-	argPos := 1
-
-	if status != "" {
-		query += ` AND status = $` + strconv.Itoa(argPos)
-		args = append(args, status)
-		argPos++
-	}
-
-	query += ` ORDER BY created_at DESC LIMIT $` + strconv.Itoa(argPos) + ` OFFSET $` + strconv.Itoa(argPos+1)
-	args = append(args, limit, offset)
-
-	rows, err := h.DB.Query(c.Context(), query, args...)
+	orders, total, err := listOrders(c.Context(), h.DB, orderFilter{Status: status}, limit, offset)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch orders"})
 	}
-	defer rows.Close()
-
-	orders := []models.Order{}
-	for rows.Next() {
-		var o models.Order
-		err := rows.Scan(
-			&o.ID, &o.CustomerEmail, &o.Status, &o.SubtotalCents,
-			&o.ShippingCents, &o.TotalCents, &o.Currency, &o.CreatedAt, &o.UpdatedAt,
-		)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "failed to scan order"})
-		}
-		orders = append(orders, o)
-	}
-
-	countQuery := `SELECT COUNT(*) FROM orders WHERE 1=1`
-	countArgs := []interface{}{}
-	countArgPos := 1
-
-	if status != "" {
-		countQuery += ` AND status = $` + strconv.Itoa(countArgPos)
-		countArgs = append(countArgs, status)
-		countArgPos++
-	}
-
-	var total int
-	err = h.DB.QueryRow(c.Context(), countQuery, countArgs...).Scan(&total)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "failed to count orders"})
-	}
 
 	return c.JSON(OrdersResponse{
 		Orders: orders,
@@ -101,55 +63,20 @@ func (h *AdminHandler) GetOrder(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "invalid order id"})
 	}
 
-	var order models.Order
-	err = h.DB.QueryRow(
-		c.Context(),
-		`SELECT id, customer_email, status, subtotal_cents, shipping_cents, total_cents, currency, created_at, updated_at 
-		 FROM orders WHERE id = $1`,
-		orderUUID,
-	).Scan(
-		&order.ID, &order.CustomerEmail, &order.Status, &order.SubtotalCents,
-		&order.ShippingCents, &order.TotalCents, &order.Currency, &order.CreatedAt, &order.UpdatedAt,
-	)
+	order, err := loadOrder(c.Context(), h.DB, orderUUID, nil)
 	if err != nil {
-		return c.Status(404).JSON(fiber.Map{"error": "order not found"})
-	}
-
-	rows, err := h.DB.Query(
-		c.Context(),
-		`SELECT id, order_id, product_id, name_snapshot, price_cents_snapshot, qty 
-		 FROM order_items WHERE order_id = $1`,
-		orderUUID,
-	)
-	if err == nil {
-		defer rows.Close()
-		for rows.Next() {
-			var item models.OrderItem
-			rows.Scan(
-				&item.ID, &item.OrderID, &item.ProductID, &item.NameSnapshot,
-				&item.PriceCentsSnapshot, &item.Qty,
-			)
-			order.Items = append(order.Items, item)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "order not found"})
 		}
-	}
-
-	var payment models.Payment
-	err = h.DB.QueryRow(
-		c.Context(),
-		`SELECT id, order_id, provider, provider_ref, status, amount_cents, currency, created_at, updated_at 
-		 FROM payments WHERE order_id = $1 ORDER BY created_at DESC LIMIT 1`,
-		orderUUID,
-	).Scan(
-		&payment.ID, &payment.OrderID, &payment.Provider, &payment.ProviderRef,
-		&payment.Status, &payment.AmountCents, &payment.Currency, &payment.CreatedAt, &payment.UpdatedAt,
-	)
-	if err == nil {
-		order.Payment = &payment
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch order"})
 	}
 
 	return c.JSON(order)
 }
 
+// releasedStatuses are the order statuses whose stock has been put back.
+var releasedStatuses = map[string]bool{"cancelled": true, "failed": true}
+
 type UpdateOrderStatusRequest struct {
 	Status string `json:"status"`
 }
@@ -167,20 +94,68 @@ func (h *AdminHandler) UpdateOrderStatus(c *fiber.Ctx) error {
 	}
 
 	validStatuses := map[string]bool{
-		"pending": true, "paid": true, "failed": true, "shipped": true, "cancelled": true,
+		"pending": true, "paid": true, "failed": true, "shipped": true, "cancelled": true, "refund_required": true,
 	}
 	if !validStatuses[req.Status] {
 		return c.Status(400).JSON(fiber.Map{"error": "invalid status"})
 	}
 
-	_, err = h.DB.Exec(
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+	}
+	defer tx.Rollback(c.Context())
+
+	var previousStatus string
+	err = tx.QueryRow(
 		c.Context(),
-		`UPDATE orders SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`,
+		`UPDATE orders o SET status = $1, updated_at = CURRENT_TIMESTAMP
+		 FROM (SELECT id, status FROM orders WHERE id = $2 FOR UPDATE) old
+		 WHERE o.id = old.id
+		 RETURNING old.status`,
 		req.Status, orderUUID,
-	)
+	).Scan(&previousStatus)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "order not found"})
+		}
 		return c.Status(500).JSON(fiber.Map{"error": "failed to update order"})
 	}
 
+	// Cancelling or failing puts the order's stock back unless it has
+	// already left the warehouse. Release is a no-op when the stock was
+	// already returned.
+	if releasedStatuses[req.Status] && previousStatus != "shipped" {
+		if err := inventory.Release(c.Context(), tx, orderUUID); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to restock order"})
+		}
+	}
+
+	// Reopening a cancelled or failed order takes its stock back, which
+	// may have been sold in the meantime.
+	if releasedStatuses[previousStatus] && !releasedStatuses[req.Status] && req.Status != "refund_required" {
+		ok, err := inventory.Reclaim(c.Context(), tx, orderUUID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to update stock"})
+		}
+		if !ok {
+			return c.Status(409).JSON(fiber.Map{"error": "the order's stock is no longer available"})
+		}
+	}
+
+	// Paid and shipped orders keep their stock for good.
+	if req.Status == "paid" || req.Status == "shipped" {
+		if err := inventory.Commit(c.Context(), tx, orderUUID); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to update stock"})
+		}
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+	}
+
+	middleware.SetAudit(c, "update_status", "order", orderUUID.String(),
+		fiber.Map{"status": previousStatus}, fiber.Map{"status": req.Status})
+
 	return c.JSON(fiber.Map{"message": "order status updated"})
 }
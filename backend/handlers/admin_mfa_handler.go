@@ -0,0 +1,350 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Biz0n58/Zaria/backend/middleware"
+	"github.com/Biz0n58/Zaria/backend/models"
+	"github.com/Biz0n58/Zaria/backend/totp"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	totpIssuer        = "Zaria"
+	recoveryCodeCount = 10
+)
+
+type TwoFactorSetupResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// SetupTwoFactor stores a new pending secret. Two-factor authentication is
+// only enforced once ConfirmTwoFactor has seen a valid code for it.
+func (h *AdminHandler) SetupTwoFactor(c *fiber.Ctx) error {
+	claims := middleware.AdminFromContext(c)
+	adminUUID, err := currentAdminID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to generate secret"})
+	}
+
+	tag, err := h.DB.Exec(
+		c.Context(),
+		`UPDATE admins SET totp_secret = $1, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $2 AND totp_enabled_at IS NULL`,
+		secret, adminUUID,
+	)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to save secret"})
+	}
+	if tag.RowsAffected() == 0 {
+		return c.Status(409).JSON(fiber.Map{"error": "two-factor authentication already enabled"})
+	}
+
+	middleware.SetAudit(c, "two_factor_setup", "admin", adminUUID.String(), nil, nil)
+
+	return c.JSON(TwoFactorSetupResponse{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(totpIssuer, claims.Email, secret),
+	})
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func (h *AdminHandler) ConfirmTwoFactor(c *fiber.Ctx) error {
+	adminUUID, err := currentAdminID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+	}
+	defer tx.Rollback(c.Context())
+
+	var secret *string
+	var enabled bool
+	err = tx.QueryRow(
+		c.Context(),
+		`SELECT totp_secret, totp_enabled_at IS NOT NULL FROM admins WHERE id = $1 FOR UPDATE`,
+		adminUUID,
+	).Scan(&secret, &enabled)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "admin not found"})
+	}
+	if enabled {
+		return c.Status(409).JSON(fiber.Map{"error": "two-factor authentication already enabled"})
+	}
+	if secret == nil {
+		return c.Status(400).JSON(fiber.Map{"error": "two-factor setup not started"})
+	}
+
+	step, ok := totp.Validate(*secret, req.Code, time.Now())
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid code"})
+	}
+
+	_, err = tx.Exec(
+		c.Context(),
+		`UPDATE admins SET totp_enabled_at = CURRENT_TIMESTAMP, totp_last_used_step = $1, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $2`,
+		step, adminUUID,
+	)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to enable two-factor authentication"})
+	}
+
+	codes, err := replaceRecoveryCodes(c.Context(), tx, adminUUID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to create recovery codes"})
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+	}
+
+	middleware.SetAudit(c, "two_factor_enable", "admin", adminUUID.String(), nil, nil)
+
+	return c.JSON(RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+type DisableTwoFactorRequest struct {
+	Password     string `json:"password"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+func (h *AdminHandler) DisableTwoFactor(c *fiber.Ctx) error {
+	adminUUID, err := currentAdminID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	var req DisableTwoFactorRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+	}
+	defer tx.Rollback(c.Context())
+
+	var passwordHash string
+	err = tx.QueryRow(c.Context(), `SELECT password_hash FROM admins WHERE id = $1`, adminUUID).Scan(&passwordHash)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "admin not found"})
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password)); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "current password is incorrect"})
+	}
+
+	if err := verifySecondFactor(c.Context(), tx, adminUUID, req.Code, req.RecoveryCode); err != nil {
+		return secondFactorError(c, err)
+	}
+
+	_, err = tx.Exec(
+		c.Context(),
+		`UPDATE admins SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_used_step = 0, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $1`,
+		adminUUID,
+	)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to disable two-factor authentication"})
+	}
+
+	_, err = tx.Exec(c.Context(), `DELETE FROM admin_recovery_codes WHERE admin_id = $1`, adminUUID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to delete recovery codes"})
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+	}
+
+	middleware.SetAudit(c, "two_factor_disable", "admin", adminUUID.String(), nil, nil)
+
+	return c.JSON(fiber.Map{"message": "two-factor authentication disabled"})
+}
+
+type VerifyTwoFactorRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+}
+
+// VerifyTwoFactor exchanges the challenge token from Login plus a TOTP or
+// recovery code for a full session.
+func (h *AdminHandler) VerifyTwoFactor(c *fiber.Ctx) error {
+	var req VerifyTwoFactorRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+
+	adminUUID, err := middleware.ParseMFAChallengeToken(req.ChallengeToken)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "invalid or expired challenge"})
+	}
+
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+	}
+	defer tx.Rollback(c.Context())
+
+	var admin models.Admin
+	err = scanAdmin(tx.QueryRow(
+		c.Context(),
+		`SELECT `+adminColumns+` FROM admins WHERE id = $1`,
+		adminUUID,
+	), &admin)
+	if err != nil || admin.DisabledAt != nil || !admin.TwoFactorEnabled {
+		return c.Status(401).JSON(fiber.Map{"error": "invalid or expired challenge"})
+	}
+
+	// Codes are guessable in far fewer attempts than passwords, so the same
+	// throttling as the password step applies here.
+	email := strings.ToLower(admin.Email)
+	retryAfter, err := loginRetryAfter(c.Context(), tx, adminLoginScopes, c.IP(), email)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to check login attempts"})
+	}
+	if lockedFor, err := adminLockedFor(c.Context(), tx, admin.ID); err == nil && lockedFor > retryAfter {
+		retryAfter = lockedFor
+	}
+	if retryAfter > 0 {
+		return tooManyAttempts(c, retryAfter)
+	}
+
+	if err := verifySecondFactor(c.Context(), tx, admin.ID, req.Code, req.RecoveryCode); err != nil {
+		if errors.Is(err, errSecondFactorInvalid) {
+			// Release the row lock taken by verifySecondFactor before the
+			// failure is recorded on the same admins row.
+			tx.Rollback(c.Context())
+			_ = recordLoginFailure(c.Context(), h.DB, adminLoginScopes, c.IP(), email, &admin.ID)
+		}
+		return secondFactorError(c, err)
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+	}
+
+	return h.completeLogin(c, admin)
+}
+
+var (
+	errSecondFactorRequired = errors.New("code or recovery_code is required")
+	errSecondFactorInvalid  = errors.New("invalid code")
+)
+
+// verifySecondFactor accepts either a TOTP code that has not been used
+// before or an unused recovery code, consuming it in both cases.
+func verifySecondFactor(ctx context.Context, tx pgx.Tx, adminID uuid.UUID, code, recoveryCode string) error {
+	if code != "" {
+		var secret *string
+		var lastStep int64
+		err := tx.QueryRow(
+			ctx,
+			`SELECT totp_secret, totp_last_used_step FROM admins
+			 WHERE id = $1 AND totp_enabled_at IS NOT NULL FOR UPDATE`,
+			adminID,
+		).Scan(&secret, &lastStep)
+		if err != nil || secret == nil {
+			return errSecondFactorInvalid
+		}
+
+		step, ok := totp.Validate(*secret, code, time.Now())
+		if !ok || step <= lastStep {
+			return errSecondFactorInvalid
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE admins SET totp_last_used_step = $1 WHERE id = $2`, step, adminID)
+		return err
+	}
+
+	if recoveryCode != "" {
+		tag, err := tx.Exec(
+			ctx,
+			`UPDATE admin_recovery_codes SET used_at = CURRENT_TIMESTAMP
+			 WHERE admin_id = $1 AND code_hash = $2 AND used_at IS NULL`,
+			adminID, hashToken(normalizeRecoveryCode(recoveryCode)),
+		)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return errSecondFactorInvalid
+		}
+		return nil
+	}
+
+	return errSecondFactorRequired
+}
+
+func secondFactorError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, errSecondFactorRequired):
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, errSecondFactorInvalid):
+		return c.Status(401).JSON(fiber.Map{"error": err.Error()})
+	default:
+		return c.Status(500).JSON(fiber.Map{"error": "failed to verify code"})
+	}
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, adminID uuid.UUID) ([]string, error) {
+	codes, err := generateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM admin_recovery_codes WHERE admin_id = $1`, adminID); err != nil {
+		return nil, err
+	}
+
+	for _, code := range codes {
+		_, err := tx.Exec(
+			ctx,
+			`INSERT INTO admin_recovery_codes (admin_id, code_hash) VALUES ($1, $2)`,
+			adminID, hashToken(normalizeRecoveryCode(code)),
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return codes, nil
+}
+
+func currentAdminID(c *fiber.Ctx) (uuid.UUID, error) {
+	claims := middleware.AdminFromContext(c)
+	if claims == nil {
+		return uuid.Nil, errors.New("no authenticated admin")
+	}
+	return uuid.Parse(claims.AdminID)
+}
@@ -0,0 +1,504 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/mail"
+	"strings"
+
+	"github.com/Biz0n58/Zaria/backend/middleware"
+	"github.com/Biz0n58/Zaria/backend/models"
+	"github.com/Biz0n58/Zaria/backend/passwords"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const minPasswordLength = 8
+
+const adminColumns = `id, email, password_hash, role, password_reset_required, totp_enabled_at IS NOT NULL, failed_login_count, locked_until, disabled_at, created_at, updated_at`
+
+func scanAdmin(row pgx.Row, a *models.Admin) error {
+	return row.Scan(
+		&a.ID, &a.Email, &a.PasswordHash, &a.Role, &a.PasswordResetRequired,
+		&a.TwoFactorEnabled, &a.FailedLoginCount, &a.LockedUntil, &a.DisabledAt, &a.CreatedAt, &a.UpdatedAt,
+	)
+}
+
+func loadAdmin(ctx context.Context, db querier, adminID uuid.UUID) (models.Admin, error) {
+	var a models.Admin
+	err := scanAdmin(db.QueryRow(ctx, `SELECT `+adminColumns+` FROM admins WHERE id = $1`, adminID), &a)
+	return a, err
+}
+
+var errLastOwner = errors.New("at least one active owner is required")
+
+type AdminsResponse struct {
+	Admins []models.Admin `json:"admins"`
+}
+
+func (h *AdminHandler) ListAdmins(c *fiber.Ctx) error {
+	rows, err := h.DB.Query(c.Context(), `SELECT `+adminColumns+` FROM admins ORDER BY created_at ASC`)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch admins"})
+	}
+	defer rows.Close()
+
+	admins := []models.Admin{}
+	for rows.Next() {
+		var a models.Admin
+		if err := scanAdmin(rows, &a); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to scan admin"})
+		}
+		admins = append(admins, a)
+	}
+
+	return c.JSON(AdminsResponse{Admins: admins})
+}
+
+type InviteAdminRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+// TemporaryPasswordResponse is the only time a generated password is
+// returned; it is never stored in plain text.
+type TemporaryPasswordResponse struct {
+	Admin             models.Admin `json:"admin"`
+	TemporaryPassword string       `json:"temporary_password"`
+}
+
+func (h *AdminHandler) InviteAdmin(c *fiber.Ctx) error {
+	var req InviteAdminRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if _, err := mail.ParseAddress(email); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "valid email is required"})
+	}
+	if req.Role == "" {
+		req.Role = middleware.RoleSupport
+	}
+	if !middleware.IsValidRole(req.Role) {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid role"})
+	}
+
+	password, err := passwords.Temporary()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to generate password"})
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to hash password"})
+	}
+
+	var admin models.Admin
+	err = scanAdmin(h.DB.QueryRow(
+		c.Context(),
+		`INSERT INTO admins (email, password_hash, role, password_reset_required)
+		 VALUES ($1, $2, $3, true)
+		 RETURNING `+adminColumns,
+		email, string(hash), req.Role,
+	), &admin)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return c.Status(409).JSON(fiber.Map{"error": "admin with this email already exists"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "failed to create admin"})
+	}
+
+	middleware.SetAudit(c, "invite", "admin", admin.ID.String(), nil, admin)
+
+	return c.Status(201).JSON(TemporaryPasswordResponse{
+		Admin:             admin,
+		TemporaryPassword: password,
+	})
+}
+
+type UpdateAdminRequest struct {
+	Role string `json:"role"`
+}
+
+func (h *AdminHandler) UpdateAdmin(c *fiber.Ctx) error {
+	adminUUID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid admin id"})
+	}
+
+	var req UpdateAdminRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+	if !middleware.IsValidRole(req.Role) {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid role"})
+	}
+
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+	}
+	defer tx.Rollback(c.Context())
+
+	before, err := loadAdmin(c.Context(), tx, adminUUID)
+	if err != nil {
+		return adminMutationError(c, err)
+	}
+
+	if req.Role != middleware.RoleOwner {
+		if err := ensureAnotherOwner(c.Context(), tx, adminUUID); err != nil {
+			return adminMutationError(c, err)
+		}
+	}
+
+	var admin models.Admin
+	err = scanAdmin(tx.QueryRow(
+		c.Context(),
+		`UPDATE admins SET role = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2 RETURNING `+adminColumns,
+		req.Role, adminUUID,
+	), &admin)
+	if err != nil {
+		return adminMutationError(c, err)
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+	}
+
+	middleware.SetAudit(c, "update_role", "admin", admin.ID.String(), before, admin)
+
+	return c.JSON(admin)
+}
+
+func (h *AdminHandler) DisableAdmin(c *fiber.Ctx) error {
+	adminUUID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid admin id"})
+	}
+	if isCurrentAdmin(c, adminUUID) {
+		return c.Status(400).JSON(fiber.Map{"error": "cannot disable your own account"})
+	}
+
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+	}
+	defer tx.Rollback(c.Context())
+
+	before, err := loadAdmin(c.Context(), tx, adminUUID)
+	if err != nil {
+		return adminMutationError(c, err)
+	}
+
+	if err := ensureAnotherOwner(c.Context(), tx, adminUUID); err != nil {
+		return adminMutationError(c, err)
+	}
+
+	var admin models.Admin
+	err = scanAdmin(tx.QueryRow(
+		c.Context(),
+		`UPDATE admins SET disabled_at = COALESCE(disabled_at, CURRENT_TIMESTAMP), updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $1 RETURNING `+adminColumns,
+		adminUUID,
+	), &admin)
+	if err != nil {
+		return adminMutationError(c, err)
+	}
+
+	if err := revokeAdminSessions(c.Context(), tx, adminUUID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to revoke sessions"})
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+	}
+
+	middleware.SetAudit(c, "disable", "admin", admin.ID.String(), before, admin)
+
+	return c.JSON(admin)
+}
+
+func (h *AdminHandler) EnableAdmin(c *fiber.Ctx) error {
+	adminUUID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid admin id"})
+	}
+
+	before, err := loadAdmin(c.Context(), h.DB, adminUUID)
+	if err != nil {
+		return adminMutationError(c, err)
+	}
+
+	var admin models.Admin
+	err = scanAdmin(h.DB.QueryRow(
+		c.Context(),
+		`UPDATE admins SET disabled_at = NULL, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $1 RETURNING `+adminColumns,
+		adminUUID,
+	), &admin)
+	if err != nil {
+		return adminMutationError(c, err)
+	}
+
+	middleware.SetAudit(c, "enable", "admin", admin.ID.String(), before, admin)
+
+	return c.JSON(admin)
+}
+
+func (h *AdminHandler) UnlockAdmin(c *fiber.Ctx) error {
+	adminUUID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid admin id"})
+	}
+
+	before, err := loadAdmin(c.Context(), h.DB, adminUUID)
+	if err != nil {
+		return adminMutationError(c, err)
+	}
+
+	var admin models.Admin
+	err = scanAdmin(h.DB.QueryRow(
+		c.Context(),
+		`UPDATE admins SET failed_login_count = 0, locked_until = NULL, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $1 RETURNING `+adminColumns,
+		adminUUID,
+	), &admin)
+	if err != nil {
+		return adminMutationError(c, err)
+	}
+
+	_, err = h.DB.Exec(
+		c.Context(),
+		`DELETE FROM login_attempts WHERE scope = $1 AND key = $2`,
+		throttleScopeEmail, strings.ToLower(admin.Email),
+	)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to clear login attempts"})
+	}
+
+	middleware.SetAudit(c, "unlock", "admin", admin.ID.String(), before, admin)
+
+	return c.JSON(admin)
+}
+
+func (h *AdminHandler) DeleteAdmin(c *fiber.Ctx) error {
+	adminUUID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid admin id"})
+	}
+	if isCurrentAdmin(c, adminUUID) {
+		return c.Status(400).JSON(fiber.Map{"error": "cannot delete your own account"})
+	}
+
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+	}
+	defer tx.Rollback(c.Context())
+
+	before, err := loadAdmin(c.Context(), tx, adminUUID)
+	if err != nil {
+		return adminMutationError(c, err)
+	}
+
+	if err := ensureAnotherOwner(c.Context(), tx, adminUUID); err != nil {
+		return adminMutationError(c, err)
+	}
+
+	if _, err := tx.Exec(c.Context(), `DELETE FROM admins WHERE id = $1`, adminUUID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to delete admin"})
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+	}
+
+	middleware.SetAudit(c, "", "admin", adminUUID.String(), before, nil)
+
+	return c.JSON(fiber.Map{"message": "admin deleted"})
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// ChangeOwnPassword is reachable while a password reset is pending, so it
+// only requires a valid session rather than a permission.
+func (h *AdminHandler) ChangeOwnPassword(c *fiber.Ctx) error {
+	claims := middleware.AdminFromContext(c)
+	if claims == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	adminUUID, err := uuid.Parse(claims.AdminID)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	sessionID, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	var req ChangePasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+	if len(req.NewPassword) < minPasswordLength {
+		return c.Status(400).JSON(fiber.Map{"error": "new_password must be at least 8 characters"})
+	}
+	if req.NewPassword == req.CurrentPassword {
+		return c.Status(400).JSON(fiber.Map{"error": "new_password must differ from current_password"})
+	}
+
+	var currentHash string
+	err = h.DB.QueryRow(c.Context(), `SELECT password_hash FROM admins WHERE id = $1`, adminUUID).Scan(&currentHash)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "admin not found"})
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(currentHash), []byte(req.CurrentPassword)); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "current password is incorrect"})
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to hash password"})
+	}
+
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+	}
+	defer tx.Rollback(c.Context())
+
+	_, err = tx.Exec(
+		c.Context(),
+		`UPDATE admins SET password_hash = $1, password_reset_required = false, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $2`,
+		string(hash), adminUUID,
+	)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to update password"})
+	}
+
+	// Sign out every other session; the one making the change stays valid.
+	_, err = tx.Exec(
+		c.Context(),
+		`UPDATE admin_sessions SET revoked_at = CURRENT_TIMESTAMP
+		 WHERE admin_id = $1 AND family_id <> $2 AND revoked_at IS NULL`,
+		adminUUID, sessionID,
+	)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to revoke sessions"})
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+	}
+
+	middleware.SetAudit(c, "change_password", "admin", adminUUID.String(), nil, nil)
+
+	return c.JSON(fiber.Map{"message": "password updated"})
+}
+
+func (h *AdminHandler) ForcePasswordReset(c *fiber.Ctx) error {
+	adminUUID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid admin id"})
+	}
+
+	password, err := passwords.Temporary()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to generate password"})
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to hash password"})
+	}
+
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+	}
+	defer tx.Rollback(c.Context())
+
+	var admin models.Admin
+	err = scanAdmin(tx.QueryRow(
+		c.Context(),
+		`UPDATE admins SET password_hash = $1, password_reset_required = true, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $2 RETURNING `+adminColumns,
+		string(hash), adminUUID,
+	), &admin)
+	if err != nil {
+		return adminMutationError(c, err)
+	}
+
+	if err := revokeAdminSessions(c.Context(), tx, adminUUID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to revoke sessions"})
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+	}
+
+	middleware.SetAudit(c, "force_password_reset", "admin", admin.ID.String(), nil, admin)
+
+	return c.JSON(TemporaryPasswordResponse{
+		Admin:             admin,
+		TemporaryPassword: password,
+	})
+}
+
+func isCurrentAdmin(c *fiber.Ctx, adminID uuid.UUID) bool {
+	claims := middleware.AdminFromContext(c)
+	return claims != nil && claims.AdminID == adminID.String()
+}
+
+// ensureAnotherOwner refuses changes that would leave no active owner able to
+// manage admins. It is a no-op when adminID is not an active owner. Checks
+// are serialized until the transaction ends, so that two requests cannot
+// each remove a different one of the last two owners.
+func ensureAnotherOwner(ctx context.Context, db querier, adminID uuid.UUID) error {
+	_, err := db.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('admins_last_owner'))`)
+	if err != nil {
+		return err
+	}
+
+	var isOwner bool
+	err = db.QueryRow(
+		ctx,
+		`SELECT role = $2 AND disabled_at IS NULL FROM admins WHERE id = $1`,
+		adminID, middleware.RoleOwner,
+	).Scan(&isOwner)
+	if err != nil || !isOwner {
+		return err
+	}
+
+	var others int
+	err = db.QueryRow(
+		ctx,
+		`SELECT COUNT(*) FROM admins WHERE role = $1 AND disabled_at IS NULL AND id <> $2`,
+		middleware.RoleOwner, adminID,
+	).Scan(&others)
+	if err != nil {
+		return err
+	}
+	if others == 0 {
+		return errLastOwner
+	}
+	return nil
+}
+
+func adminMutationError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return c.Status(404).JSON(fiber.Map{"error": "admin not found"})
+	case errors.Is(err, errLastOwner):
+		return c.Status(409).JSON(fiber.Map{"error": errLastOwner.Error()})
+	default:
+		return c.Status(500).JSON(fiber.Map{"error": "failed to update admin"})
+	}
+}
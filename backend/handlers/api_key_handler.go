@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Biz0n58/Zaria/backend/middleware"
+	"github.com/Biz0n58/Zaria/backend/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type APIKeyHandler struct {
+	DB *pgxpool.Pool
+}
+
+func NewAPIKeyHandler(db *pgxpool.Pool) *APIKeyHandler {
+	return &APIKeyHandler{DB: db}
+}
+
+const apiKeyColumns = `id, name, key_prefix, scopes, created_by, expires_at, last_used_at, revoked_at, created_at`
+
+func scanAPIKey(row pgx.Row, k *models.APIKey) error {
+	return row.Scan(
+		&k.ID, &k.Name, &k.KeyPrefix, &k.Scopes, &k.CreatedBy,
+		&k.ExpiresAt, &k.LastUsedAt, &k.RevokedAt, &k.CreatedAt,
+	)
+}
+
+type APIKeysResponse struct {
+	APIKeys []models.APIKey `json:"api_keys"`
+}
+
+func (h *APIKeyHandler) ListAPIKeys(c *fiber.Ctx) error {
+	rows, err := h.DB.Query(c.Context(), `SELECT `+apiKeyColumns+` FROM api_keys ORDER BY created_at DESC`)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch api keys"})
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		var k models.APIKey
+		if err := scanAPIKey(rows, &k); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to scan api key"})
+		}
+		keys = append(keys, k)
+	}
+
+	return c.JSON(APIKeysResponse{APIKeys: keys})
+}
+
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreateAPIKeyResponse carries the plain key, which is never shown again.
+type CreateAPIKeyResponse struct {
+	APIKey models.APIKey `json:"api_key"`
+	Key    string        `json:"key"`
+}
+
+func (h *APIKeyHandler) CreateAPIKey(c *fiber.Ctx) error {
+	claims := middleware.AdminFromContext(c)
+	creatorID, err := uuid.Parse(claims.AdminID)
+	if err != nil {
+		return c.Status(403).JSON(fiber.Map{"error": "api keys can only be created by an admin"})
+	}
+
+	var req CreateAPIKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "name is required"})
+	}
+	if len(req.Scopes) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "at least one scope is required"})
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(middleware.APIKeyScopes, scope) {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid scope: " + scope})
+		}
+		// Nobody can hand out more access than they hold themselves.
+		if !middleware.HasPermission(claims.Role, scope) {
+			return c.Status(403).JSON(fiber.Map{"error": "cannot grant scope: " + scope})
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return c.Status(400).JSON(fiber.Map{"error": "expires_at must be in the future"})
+	}
+
+	token, _, err := generateOpaqueToken()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to generate api key"})
+	}
+	key := middleware.APIKeyPrefix + token
+
+	var apiKey models.APIKey
+	err = scanAPIKey(h.DB.QueryRow(
+		c.Context(),
+		`INSERT INTO api_keys (name, key_prefix, key_hash, scopes, created_by, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 RETURNING `+apiKeyColumns,
+		req.Name, key[:len(middleware.APIKeyPrefix)+6], middleware.HashAPIKey(key), req.Scopes, creatorID, req.ExpiresAt,
+	), &apiKey)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to create api key"})
+	}
+
+	middleware.SetAudit(c, "", "api_key", apiKey.ID.String(), nil, apiKey)
+
+	return c.Status(201).JSON(CreateAPIKeyResponse{
+		APIKey: apiKey,
+		Key:    key,
+	})
+}
+
+func (h *APIKeyHandler) RevokeAPIKey(c *fiber.Ctx) error {
+	keyUUID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid api key id"})
+	}
+
+	var apiKey models.APIKey
+	err = scanAPIKey(h.DB.QueryRow(
+		c.Context(),
+		`UPDATE api_keys SET revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP)
+		 WHERE id = $1 RETURNING `+apiKeyColumns,
+		keyUUID,
+	), &apiKey)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "api key not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "failed to revoke api key"})
+	}
+
+	middleware.SetAudit(c, "revoke", "api_key", apiKey.ID.String(), nil, apiKey)
+
+	return c.JSON(apiKey)
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Biz0n58/Zaria/backend/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type AuditHandler struct {
+	DB *pgxpool.Pool
+}
+
+func NewAuditHandler(db *pgxpool.Pool) *AuditHandler {
+	return &AuditHandler{DB: db}
+}
+
+type AuditLogResponse struct {
+	Entries []models.AuditLogEntry `json:"entries"`
+	Total   int                    `json:"total"`
+	Page    int                    `json:"page"`
+	Limit   int                    `json:"limit"`
+}
+
+// parseAuditTime accepts either RFC 3339 timestamps or plain dates.
+func parseAuditTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+func (h *AuditHandler) GetAuditLog(c *fiber.Ctx) error {
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "50"))
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+	offset := (page - 1) * limit
+
+	where := ` WHERE 1=1`
+	args := []interface{}{}
+
+	if adminID := c.Query("admin_id"); adminID != "" {
+		adminUUID, err := uuid.Parse(adminID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid admin_id"})
+		}
+		args = append(args, adminUUID)
+		where += ` AND admin_id = $` + strconv.Itoa(len(args))
+	}
+
+	if apiKeyID := c.Query("api_key_id"); apiKeyID != "" {
+		apiKeyUUID, err := uuid.Parse(apiKeyID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid api_key_id"})
+		}
+		args = append(args, apiKeyUUID)
+		where += ` AND api_key_id = $` + strconv.Itoa(len(args))
+	}
+
+	if entityType := c.Query("entity_type"); entityType != "" {
+		args = append(args, entityType)
+		where += ` AND entity_type = $` + strconv.Itoa(len(args))
+	}
+
+	if entityID := c.Query("entity_id"); entityID != "" {
+		args = append(args, entityID)
+		where += ` AND entity_id = $` + strconv.Itoa(len(args))
+	}
+
+	if from := c.Query("from"); from != "" {
+		t, err := parseAuditTime(from)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid from date"})
+		}
+		args = append(args, t)
+		where += ` AND created_at >= $` + strconv.Itoa(len(args))
+	}
+
+	if to := c.Query("to"); to != "" {
+		t, err := parseAuditTime(to)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid to date"})
+		}
+		// A plain date includes the whole day.
+		if len(to) == len("2006-01-02") {
+			t = t.AddDate(0, 0, 1)
+		}
+		args = append(args, t)
+		where += ` AND created_at < $` + strconv.Itoa(len(args))
+	}
+
+	var total int
+	err := h.DB.QueryRow(c.Context(), `SELECT COUNT(*) FROM audit_log`+where, args...).Scan(&total)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to count audit entries"})
+	}
+
+	query := `SELECT id, admin_id, api_key_id, action, entity_type, entity_id, method, path, status_code, before, after, changes, ip_address, user_agent, created_at
+		 FROM audit_log` + where +
+		` ORDER BY created_at DESC LIMIT $` + strconv.Itoa(len(args)+1) + ` OFFSET $` + strconv.Itoa(len(args)+2)
+
+	rows, err := h.DB.Query(c.Context(), query, append(args, limit, offset)...)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch audit entries"})
+	}
+	defer rows.Close()
+
+	entries := []models.AuditLogEntry{}
+	for rows.Next() {
+		var e models.AuditLogEntry
+		err := rows.Scan(
+			&e.ID, &e.AdminID, &e.APIKeyID, &e.Action, &e.EntityType, &e.EntityID, &e.Method, &e.Path, &e.StatusCode,
+			&e.Before, &e.After, &e.Changes, &e.IPAddress, &e.UserAgent, &e.CreatedAt,
+		)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to scan audit entry"})
+		}
+		entries = append(entries, e)
+	}
+
+	return c.JSON(AuditLogResponse{
+		Entries: entries,
+		Total:   total,
+		Page:    page,
+		Limit:   limit,
+	})
+}
@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/Biz0n58/Zaria/backend/models"
+	"github.com/Biz0n58/Zaria/backend/pricing"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const maxCartItemQty = 999
+
+type CartHandler struct {
+	DB *pgxpool.Pool
+}
+
+func NewCartHandler(db *pgxpool.Pool) *CartHandler {
+	return &CartHandler{DB: db}
+}
+
+// CartResponse includes the cart token only when an anonymous cart is
+// created; clients send it back in the X-Cart-Token header.
+type CartResponse struct {
+	models.Cart
+	CartToken string `json:"cart_token,omitempty"`
+}
+
+// CreateCartRequest optionally sets the currency the cart is priced in; an
+// existing customer cart keeps its currency unless one is sent.
+type CreateCartRequest struct {
+	Currency string `json:"currency"`
+}
+
+type CartItemRequest struct {
+	ProductID string `json:"product_id"`
+	// VariantID is required for products sold in variants.
+	VariantID string `json:"variant_id"`
+	Qty       int    `json:"qty"`
+}
+
+// CreateCart returns the customer's open cart, creating it if needed, or a
+// new anonymous cart for guests.
+func (h *CartHandler) CreateCart(c *fiber.Ctx) error {
+	customerID, err := optionalCustomerID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	var req CreateCartRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+		}
+	}
+	rates, err := exchangeRates(c.Context(), h.DB)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch exchange rates"})
+	}
+	code, ferr := supportedCurrency(rates, req.Currency)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
+	var cartCurrency *string
+	if code != "" {
+		cartCurrency = &code
+	}
+
+	var cartID uuid.UUID
+	var resp CartResponse
+	if customerID != nil {
+		err = h.DB.QueryRow(
+			c.Context(),
+			`INSERT INTO carts (customer_id, currency) VALUES ($1, COALESCE($2::varchar, $3))
+			 ON CONFLICT (customer_id) WHERE converted_at IS NULL DO UPDATE SET
+			   currency = COALESCE($2::varchar, carts.currency)
+			 RETURNING id`,
+			*customerID, cartCurrency, pricing.DefaultCurrency,
+		).Scan(&cartID)
+	} else {
+		var token, hash string
+		token, hash, err = generateOpaqueToken()
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to generate cart token"})
+		}
+		resp.CartToken = token
+		err = h.DB.QueryRow(
+			c.Context(),
+			`INSERT INTO carts (token_hash, currency) VALUES ($1, COALESCE($2::varchar, $3)) RETURNING id`,
+			hash, cartCurrency, pricing.DefaultCurrency,
+		).Scan(&cartID)
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to create cart"})
+	}
+
+	resp.Cart, err = loadCart(c.Context(), h.DB, cartID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch cart"})
+	}
+
+	return c.Status(201).JSON(resp)
+}
+
+func (h *CartHandler) GetCart(c *fiber.Ctx) error {
+	cartID, ferr := h.authorize(c)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
+
+	cart, err := loadCart(c.Context(), h.DB, cartID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch cart"})
+	}
+
+	return c.JSON(cart)
+}
+
+// AddItem adds qty (default 1) of a product or variant, on top of any
+// quantity already in the cart.
+func (h *CartHandler) AddItem(c *fiber.Ctx) error {
+	cartID, ferr := h.authorize(c)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
+
+	var req CartItemRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+	productUUID, err := uuid.Parse(req.ProductID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid product id"})
+	}
+	variantID, ferr := parseVariantID(req.VariantID)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
+	if req.Qty == 0 {
+		req.Qty = 1
+	}
+	if req.Qty < 1 || req.Qty > maxCartItemQty {
+		return c.Status(400).JSON(fiber.Map{"error": "qty must be between 1 and 999"})
+	}
+
+	var active bool
+	err = h.DB.QueryRow(c.Context(), `SELECT is_active FROM products WHERE id = $1`, productUUID).Scan(&active)
+	if err != nil || !active {
+		return c.Status(404).JSON(fiber.Map{"error": "product not found"})
+	}
+	if ferr := checkVariant(c.Context(), h.DB, productUUID, variantID); ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
+
+	if variantID != nil {
+		_, err = h.DB.Exec(
+			c.Context(),
+			`INSERT INTO cart_items (cart_id, product_id, variant_id, qty) VALUES ($1, $2, $3, $4)
+			 ON CONFLICT (cart_id, variant_id) WHERE variant_id IS NOT NULL DO UPDATE SET
+			   qty = LEAST(cart_items.qty + EXCLUDED.qty, $5),
+			   updated_at = CURRENT_TIMESTAMP`,
+			cartID, productUUID, *variantID, req.Qty, maxCartItemQty,
+		)
+	} else {
+		_, err = h.DB.Exec(
+			c.Context(),
+			`INSERT INTO cart_items (cart_id, product_id, qty) VALUES ($1, $2, $3)
+			 ON CONFLICT (cart_id, product_id) WHERE variant_id IS NULL DO UPDATE SET
+			   qty = LEAST(cart_items.qty + EXCLUDED.qty, $4),
+			   updated_at = CURRENT_TIMESTAMP`,
+			cartID, productUUID, req.Qty, maxCartItemQty,
+		)
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to add item"})
+	}
+
+	return h.respondWithCart(c, cartID)
+}
+
+// UpdateItem sets the quantity of a product in the cart; zero removes it.
+// Variants are picked with ?variant_id=.
+func (h *CartHandler) UpdateItem(c *fiber.Ctx) error {
+	cartID, ferr := h.authorize(c)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
+
+	productUUID, err := uuid.Parse(c.Params("product_id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid product id"})
+	}
+	variantID, ferr := parseVariantID(c.Query("variant_id"))
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
+
+	var req CartItemRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+	if req.Qty < 0 || req.Qty > maxCartItemQty {
+		return c.Status(400).JSON(fiber.Map{"error": "qty must be between 0 and 999"})
+	}
+
+	if req.Qty == 0 {
+		return h.removeItem(c, cartID, productUUID, variantID)
+	}
+
+	tag, err := h.DB.Exec(
+		c.Context(),
+		`UPDATE cart_items SET qty = $4, updated_at = CURRENT_TIMESTAMP
+		 WHERE cart_id = $1 AND product_id = $2 AND variant_id IS NOT DISTINCT FROM $3`,
+		cartID, productUUID, variantID, req.Qty,
+	)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to update item"})
+	}
+	if tag.RowsAffected() == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "item not in cart"})
+	}
+
+	return h.respondWithCart(c, cartID)
+}
+
+func (h *CartHandler) RemoveItem(c *fiber.Ctx) error {
+	cartID, ferr := h.authorize(c)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
+
+	productUUID, err := uuid.Parse(c.Params("product_id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid product id"})
+	}
+	variantID, ferr := parseVariantID(c.Query("variant_id"))
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
+
+	return h.removeItem(c, cartID, productUUID, variantID)
+}
+
+func (h *CartHandler) removeItem(c *fiber.Ctx, cartID, productID uuid.UUID, variantID *uuid.UUID) error {
+	tag, err := h.DB.Exec(
+		c.Context(),
+		`DELETE FROM cart_items WHERE cart_id = $1 AND product_id = $2 AND variant_id IS NOT DISTINCT FROM $3`,
+		cartID, productID, variantID,
+	)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to remove item"})
+	}
+	if tag.RowsAffected() == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "item not in cart"})
+	}
+
+	return h.respondWithCart(c, cartID)
+}
+
+func (h *CartHandler) respondWithCart(c *fiber.Ctx, cartID uuid.UUID) error {
+	_, err := h.DB.Exec(c.Context(), `UPDATE carts SET updated_at = CURRENT_TIMESTAMP WHERE id = $1`, cartID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to update cart"})
+	}
+
+	cart, err := loadCart(c.Context(), h.DB, cartID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch cart"})
+	}
+
+	return c.JSON(cart)
+}
+
+// authorize parses the :id param and checks the caller may use that cart.
+func (h *CartHandler) authorize(c *fiber.Ctx) (uuid.UUID, *fiber.Error) {
+	cartID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return uuid.Nil, fiber.NewError(400, "invalid cart id")
+	}
+
+	customerID, err := optionalCustomerID(c)
+	if err != nil {
+		return uuid.Nil, fiber.NewError(401, "unauthorized")
+	}
+
+	err = authorizeCart(c.Context(), h.DB, cartID, customerID, c.Get(CartTokenHeader), false)
+	if errors.Is(err, errCartNotFound) {
+		return uuid.Nil, fiber.NewError(404, "cart not found")
+	}
+	if err != nil {
+		return uuid.Nil, fiber.NewError(500, "failed to fetch cart")
+	}
+
+	return cartID, nil
+}
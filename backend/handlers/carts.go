@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/Biz0n58/Zaria/backend/middleware"
+	"github.com/Biz0n58/Zaria/backend/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// CartTokenHeader carries the token of an anonymous cart.
+const CartTokenHeader = "X-Cart-Token"
+
+var errCartNotFound = errors.New("cart not found")
+
+// optionalCustomerID returns the customer authenticated by OptionalCustomer,
+// or nil for guests.
+func optionalCustomerID(c *fiber.Ctx) (*uuid.UUID, error) {
+	claims := middleware.CustomerFromContext(c)
+	if claims == nil {
+		return nil, nil
+	}
+	id, err := uuid.Parse(claims.CustomerID)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// authorizeCart checks that the open cart is owned by the customer or, for
+// anonymous carts, that cartToken matches. Carts the caller may not use are
+// reported as errCartNotFound. With lock set the cart row is locked for the
+// rest of the transaction.
+func authorizeCart(ctx context.Context, db querier, cartID uuid.UUID, customerID *uuid.UUID, cartToken string, lock bool) error {
+	query := `SELECT customer_id, token_hash FROM carts WHERE id = $1 AND converted_at IS NULL`
+	if lock {
+		query += ` FOR UPDATE`
+	}
+
+	var owner *uuid.UUID
+	var tokenHash *string
+	err := db.QueryRow(ctx, query, cartID).Scan(&owner, &tokenHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errCartNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if owner != nil {
+		if customerID != nil && *owner == *customerID {
+			return nil
+		}
+		return errCartNotFound
+	}
+	if tokenHash != nil && cartToken != "" && hashToken(cartToken) == *tokenHash {
+		return nil
+	}
+	return errCartNotFound
+}
+
+// loadCart returns the cart with current product names, prices in the
+// cart's currency, and stock. Items of a variant use the variant's price,
+// image and stock.
+func loadCart(ctx context.Context, db querier, cartID uuid.UUID) (models.Cart, error) {
+	cart := models.Cart{Items: []models.CartItem{}}
+	err := db.QueryRow(
+		ctx,
+		`SELECT id, customer_id, currency, created_at, updated_at FROM carts WHERE id = $1`,
+		cartID,
+	).Scan(&cart.ID, &cart.CustomerID, &cart.Currency, &cart.CreatedAt, &cart.UpdatedAt)
+	if err != nil {
+		return cart, err
+	}
+
+	rates, err := exchangeRates(ctx, db)
+	if err != nil {
+		return cart, err
+	}
+
+	rows, err := db.Query(
+		ctx,
+		`SELECT ci.id, ci.product_id, ci.variant_id, v.sku, `+variantOptionsSQL+`,
+		        ci.qty, ci.created_at, ci.updated_at,
+		        p.name, COALESCE(v.image_url, p.image_url), COALESCE(v.price_cents, p.price_cents), p.currency,
+		        CASE WHEN v.price_cents IS NULL THEN
+		          (SELECT pp.price_cents FROM product_prices pp WHERE pp.product_id = p.id AND pp.currency = $2)
+		        END,
+		        COALESCE(v.stock, p.stock), p.is_active AND COALESCE(v.is_active, true),
+		        ci.variant_id IS NULL AND EXISTS (SELECT 1 FROM product_variants WHERE product_id = p.id)
+		 FROM cart_items ci
+		 JOIN products p ON p.id = ci.product_id
+		 LEFT JOIN product_variants v ON v.id = ci.variant_id
+		 WHERE ci.cart_id = $1
+		 ORDER BY ci.created_at`,
+		cartID, cart.Currency,
+	)
+	if err != nil {
+		return cart, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.CartItem
+		var priceCents int
+		var productCurrency string
+		var explicitPrice *int
+		var active, needsVariant bool
+		err := rows.Scan(
+			&item.ID, &item.ProductID, &item.VariantID, &item.SKU, &item.VariantOptions,
+			&item.Qty, &item.CreatedAt, &item.UpdatedAt,
+			&item.Name, &item.ImageURL, &priceCents, &productCurrency, &explicitPrice,
+			&item.AvailableStock, &active, &needsVariant,
+		)
+		if err != nil {
+			return cart, err
+		}
+
+		var priced bool
+		item.UnitPriceCents, priced = localPrice(rates, priceCents, productCurrency, explicitPrice, cart.Currency)
+		if !priced || needsVariant {
+			active = false
+		}
+
+		item.LineTotalCents = item.UnitPriceCents * item.Qty
+		switch {
+		case !priced:
+			item.Warning = "product is not available in " + strings.ToUpper(cart.Currency)
+		case needsVariant:
+			item.Warning = "choose a variant of this product"
+		case !active:
+			item.Warning = "product is no longer available"
+		case item.AvailableStock == 0:
+			item.Warning = "out of stock"
+		case item.AvailableStock < item.Qty:
+			item.Warning = "only " + strconv.Itoa(item.AvailableStock) + " left in stock"
+		default:
+			item.Available = true
+		}
+		if active {
+			cart.SubtotalCents += item.LineTotalCents
+		}
+
+		cart.Items = append(cart.Items, item)
+	}
+
+	return cart, rows.Err()
+}
+
+// cartCheckoutItems reads the items and currency of a cart for checkout.
+func cartCheckoutItems(ctx context.Context, db querier, cartID uuid.UUID) ([]CheckoutItem, string, error) {
+	var cartCurrency string
+	if err := db.QueryRow(ctx, `SELECT currency FROM carts WHERE id = $1`, cartID).Scan(&cartCurrency); err != nil {
+		return nil, "", err
+	}
+
+	rows, err := db.Query(
+		ctx,
+		`SELECT product_id, variant_id, qty FROM cart_items WHERE cart_id = $1 ORDER BY created_at`,
+		cartID,
+	)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	items := []CheckoutItem{}
+	for rows.Next() {
+		var productID uuid.UUID
+		var variantID *uuid.UUID
+		var item CheckoutItem
+		if err := rows.Scan(&productID, &variantID, &item.Qty); err != nil {
+			return nil, "", err
+		}
+		item.ProductID = productID.String()
+		if variantID != nil {
+			item.VariantID = variantID.String()
+		}
+		items = append(items, item)
+	}
+
+	return items, cartCurrency, rows.Err()
+}
+
+// mergeGuestCart moves the items of the anonymous cart identified by
+// cartToken into the customer's open cart, adding up quantities of products
+// and variants in both up to maxCartItemQty. When the customer has no open
+// cart the guest cart is simply taken over. Unknown tokens are ignored.
+func mergeGuestCart(ctx context.Context, db querier, cartToken string, customerID uuid.UUID) error {
+	if cartToken == "" {
+		return nil
+	}
+
+	var guestCartID uuid.UUID
+	err := db.QueryRow(
+		ctx,
+		`SELECT id FROM carts WHERE token_hash = $1 AND customer_id IS NULL AND converted_at IS NULL FOR UPDATE`,
+		hashToken(cartToken),
+	).Scan(&guestCartID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var customerCartID uuid.UUID
+	err = db.QueryRow(
+		ctx,
+		`SELECT id FROM carts WHERE customer_id = $1 AND converted_at IS NULL FOR UPDATE`,
+		customerID,
+	).Scan(&customerCartID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		_, err = db.Exec(
+			ctx,
+			`UPDATE carts SET customer_id = $2, token_hash = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = $1`,
+			guestCartID, customerID,
+		)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(
+		ctx,
+		`INSERT INTO cart_items (cart_id, product_id, qty)
+		 SELECT $2, product_id, qty FROM cart_items WHERE cart_id = $1 AND variant_id IS NULL
+		 ON CONFLICT (cart_id, product_id) WHERE variant_id IS NULL DO UPDATE SET
+		   qty = LEAST(cart_items.qty + EXCLUDED.qty, $3),
+		   updated_at = CURRENT_TIMESTAMP`,
+		guestCartID, customerCartID, maxCartItemQty,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(
+		ctx,
+		`INSERT INTO cart_items (cart_id, product_id, variant_id, qty)
+		 SELECT $2, product_id, variant_id, qty FROM cart_items WHERE cart_id = $1 AND variant_id IS NOT NULL
+		 ON CONFLICT (cart_id, variant_id) WHERE variant_id IS NOT NULL DO UPDATE SET
+		   qty = LEAST(cart_items.qty + EXCLUDED.qty, $3),
+		   updated_at = CURRENT_TIMESTAMP`,
+		guestCartID, customerCartID, maxCartItemQty,
+	)
+	if err != nil {
+		return err
+	}
+
+	if _, err = db.Exec(ctx, `DELETE FROM carts WHERE id = $1`, guestCartID); err != nil {
+		return err
+	}
+
+	_, err = db.Exec(ctx, `UPDATE carts SET updated_at = CURRENT_TIMESTAMP WHERE id = $1`, customerCartID)
+	return err
+}
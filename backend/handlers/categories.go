@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/Biz0n58/Zaria/backend/models"
+	"github.com/jackc/pgx/v5"
+)
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+const categoryColumns = `id, parent_id, name, slug, description, position, created_at, updated_at`
+
+func scanCategory(row pgx.Row, cat *models.Category) error {
+	return row.Scan(&cat.ID, &cat.ParentID, &cat.Name, &cat.Slug, &cat.Description, &cat.Position, &cat.CreatedAt, &cat.UpdatedAt)
+}
+
+// listCategories returns every category, ordered by position within their
+// parent.
+func listCategories(ctx context.Context, db querier) ([]models.Category, error) {
+	rows, err := db.Query(ctx, `SELECT `+categoryColumns+` FROM categories ORDER BY position, name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []models.Category{}
+	for rows.Next() {
+		var cat models.Category
+		if err := scanCategory(rows, &cat); err != nil {
+			return nil, err
+		}
+		categories = append(categories, cat)
+	}
+	return categories, rows.Err()
+}
+
+// categoryTree nests categories under their parents and returns the roots.
+func categoryTree(categories []models.Category) []models.Category {
+	children := map[string][]models.Category{}
+	for _, cat := range categories {
+		parent := ""
+		if cat.ParentID != nil {
+			parent = cat.ParentID.String()
+		}
+		children[parent] = append(children[parent], cat)
+	}
+
+	var build func(parent string) []models.Category
+	build = func(parent string) []models.Category {
+		nodes := children[parent]
+		for i := range nodes {
+			nodes[i].Children = build(nodes[i].ID.String())
+		}
+		return nodes
+	}
+
+	roots := build("")
+	if roots == nil {
+		roots = []models.Category{}
+	}
+	return roots
+}
+
+// categoryTreeSQL selects the ids of the category with slug $N and all of
+// its descendants, given the placeholder for the slug.
+func categoryTreeSQL(slugParam string) string {
+	return `WITH RECURSIVE tree AS (
+		  SELECT id FROM categories WHERE slug = ` + slugParam + `
+		  UNION
+		  SELECT c.id FROM categories c JOIN tree t ON c.parent_id = t.id
+		) SELECT id FROM tree`
+}
+
+// productInCategorySQL matches products in the category with slug $N or
+// any of its descendants.
+func productInCategorySQL(slugParam string) string {
+	return `id IN (SELECT product_id FROM product_categories WHERE category_id IN (` + categoryTreeSQL(slugParam) + `))`
+}
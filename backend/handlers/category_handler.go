@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/Biz0n58/Zaria/backend/middleware"
+	"github.com/Biz0n58/Zaria/backend/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type CategoryHandler struct {
+	DB *pgxpool.Pool
+}
+
+func NewCategoryHandler(db *pgxpool.Pool) *CategoryHandler {
+	return &CategoryHandler{DB: db}
+}
+
+type CategoryRequest struct {
+	Name        string  `json:"name"`
+	Slug        string  `json:"slug"`
+	Description string  `json:"description"`
+	ParentID    *string `json:"parent_id"`
+	Position    int     `json:"position"`
+}
+
+type CategoriesResponse struct {
+	Categories []models.Category `json:"categories"`
+}
+
+// GetCategoryTree returns all categories nested under their parents.
+func (h *CategoryHandler) GetCategoryTree(c *fiber.Ctx) error {
+	categories, err := listCategories(c.Context(), h.DB)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch categories"})
+	}
+
+	return c.JSON(CategoriesResponse{Categories: categoryTree(categories)})
+}
+
+// GetCategoryBySlug returns one category with its subcategories.
+func (h *CategoryHandler) GetCategoryBySlug(c *fiber.Ctx) error {
+	categories, err := listCategories(c.Context(), h.DB)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch categories"})
+	}
+
+	// Build the tree first so the category comes with its descendants.
+	var find func(nodes []models.Category) *models.Category
+	find = func(nodes []models.Category) *models.Category {
+		for i := range nodes {
+			if nodes[i].Slug == c.Params("slug") {
+				return &nodes[i]
+			}
+			if found := find(nodes[i].Children); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+
+	cat := find(categoryTree(categories))
+	if cat == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "category not found"})
+	}
+
+	return c.JSON(cat)
+}
+
+// ListCategories returns every category as a flat list for the admin.
+func (h *CategoryHandler) ListCategories(c *fiber.Ctx) error {
+	categories, err := listCategories(c.Context(), h.DB)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch categories"})
+	}
+
+	return c.JSON(CategoriesResponse{Categories: categories})
+}
+
+func (h *CategoryHandler) CreateCategory(c *fiber.Ctx) error {
+	var req CategoryRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+	parentID, msg := validateCategoryRequest(&req)
+	if msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	var cat models.Category
+	err := scanCategory(h.DB.QueryRow(
+		c.Context(),
+		`INSERT INTO categories (parent_id, name, slug, description, position)
+		 VALUES ($1, $2, $3, $4, $5)
+		 RETURNING `+categoryColumns,
+		parentID, req.Name, req.Slug, req.Description, req.Position,
+	), &cat)
+	if err != nil {
+		return categoryWriteError(c, err, "failed to create category")
+	}
+
+	middleware.SetAudit(c, "", "category", cat.ID.String(), nil, cat)
+
+	return c.Status(201).JSON(cat)
+}
+
+// UpdateCategory may move the category to another parent, but not below
+// itself or one of its descendants.
+func (h *CategoryHandler) UpdateCategory(c *fiber.Ctx) error {
+	categoryUUID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid category id"})
+	}
+
+	var req CategoryRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+	parentID, msg := validateCategoryRequest(&req)
+	if msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+	}
+	defer tx.Rollback(c.Context())
+
+	// Moves are serialized so that two of them cannot form a cycle.
+	if _, err := tx.Exec(c.Context(), `LOCK TABLE categories IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to lock categories"})
+	}
+
+	var before models.Category
+	err = scanCategory(tx.QueryRow(
+		c.Context(),
+		`SELECT `+categoryColumns+` FROM categories WHERE id = $1`,
+		categoryUUID,
+	), &before)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "category not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch category"})
+	}
+
+	if parentID != nil {
+		var cycle bool
+		err := tx.QueryRow(
+			c.Context(),
+			`WITH RECURSIVE tree AS (
+			   SELECT id FROM categories WHERE id = $1
+			   UNION
+			   SELECT c.id FROM categories c JOIN tree t ON c.parent_id = t.id
+			 ) SELECT EXISTS (SELECT 1 FROM tree WHERE id = $2)`,
+			categoryUUID, *parentID,
+		).Scan(&cycle)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to fetch categories"})
+		}
+		if cycle {
+			return c.Status(400).JSON(fiber.Map{"error": "a category cannot be moved below itself"})
+		}
+	}
+
+	var cat models.Category
+	err = scanCategory(tx.QueryRow(
+		c.Context(),
+		`UPDATE categories
+		 SET parent_id = $1, name = $2, slug = $3, description = $4, position = $5, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $6
+		 RETURNING `+categoryColumns,
+		parentID, req.Name, req.Slug, req.Description, req.Position, categoryUUID,
+	), &cat)
+	if err != nil {
+		return categoryWriteError(c, err, "failed to update category")
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+	}
+
+	middleware.SetAudit(c, "", "category", cat.ID.String(), before, cat)
+
+	return c.JSON(cat)
+}
+
+// DeleteCategory removes a category without subcategories that no
+// promotion targets; its products simply leave it.
+func (h *CategoryHandler) DeleteCategory(c *fiber.Ctx) error {
+	categoryUUID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid category id"})
+	}
+
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+	}
+	defer tx.Rollback(c.Context())
+
+	var cat models.Category
+	var hasChildren, inPromotions bool
+	err = tx.QueryRow(
+		c.Context(),
+		`SELECT `+categoryColumns+`,
+		   EXISTS (SELECT 1 FROM categories child WHERE child.parent_id = categories.id),
+		   EXISTS (SELECT 1 FROM promotion_categories WHERE category_id = categories.id)
+		 FROM categories WHERE id = $1 FOR UPDATE`,
+		categoryUUID,
+	).Scan(
+		&cat.ID, &cat.ParentID, &cat.Name, &cat.Slug, &cat.Description, &cat.Position, &cat.CreatedAt, &cat.UpdatedAt,
+		&hasChildren, &inPromotions,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "category not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch category"})
+	}
+	if hasChildren {
+		return c.Status(409).JSON(fiber.Map{"error": "category has subcategories"})
+	}
+	if inPromotions {
+		return c.Status(409).JSON(fiber.Map{"error": "category is used by promotions"})
+	}
+
+	if _, err := tx.Exec(c.Context(), `DELETE FROM categories WHERE id = $1`, categoryUUID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to delete category"})
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+	}
+
+	middleware.SetAudit(c, "", "category", cat.ID.String(), cat, nil)
+
+	return c.JSON(fiber.Map{"message": "category deleted"})
+}
+
+// validateCategoryRequest normalizes req and returns the parent id, or a
+// message describing the first problem.
+func validateCategoryRequest(req *CategoryRequest) (*uuid.UUID, string) {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return nil, "name is required"
+	}
+	req.Slug = strings.ToLower(strings.TrimSpace(req.Slug))
+	if !slugPattern.MatchString(req.Slug) || len(req.Slug) > 255 {
+		return nil, "slug must be lowercase letters and digits separated by '-'"
+	}
+
+	if req.ParentID == nil || *req.ParentID == "" {
+		return nil, ""
+	}
+	parentID, err := uuid.Parse(*req.ParentID)
+	if err != nil {
+		return nil, "invalid parent id"
+	}
+	return &parentID, ""
+}
+
+func categoryWriteError(c *fiber.Ctx, err error, fallback string) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "23505":
+			return c.Status(409).JSON(fiber.Map{"error": "a category with this slug already exists"})
+		case "23503":
+			return c.Status(400).JSON(fiber.Map{"error": "parent category not found"})
+		}
+	}
+	return c.Status(500).JSON(fiber.Map{"error": fallback})
+}
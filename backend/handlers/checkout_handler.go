@@ -1,7 +1,16 @@
 package handlers
 
 import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Biz0n58/Zaria/backend/inventory"
+	"github.com/Biz0n58/Zaria/backend/middleware"
 	"github.com/Biz0n58/Zaria/backend/models"
+	"github.com/Biz0n58/Zaria/backend/pricing"
+	"github.com/Biz0n58/Zaria/backend/shipping"
+	"github.com/Biz0n58/Zaria/backend/tax"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -17,18 +26,44 @@ func NewCheckoutHandler(db *pgxpool.Pool) *CheckoutHandler {
 
 type CheckoutItem struct {
 	ProductID string `json:"product_id"`
+	// VariantID is required for products sold in variants.
+	VariantID string `json:"variant_id"`
 	Qty       int    `json:"qty"`
 }
 
 type CheckoutRequest struct {
 	CustomerEmail string          `json:"customer_email"`
 	Items         []CheckoutItem  `json:"items"`
+	// CartID checks out a server-side cart instead of Items. Anonymous
+	// carts also need their X-Cart-Token header.
+	CartID string `json:"cart_id"`
+
+	PromoCode string `json:"promo_code"`
+
+	// Currency to check out in. It defaults to the cart's currency, or to
+	// the products' own currency when they all share one.
+	Currency string `json:"currency"`
+
+	// ShippingMethod is the code of one of the offered shipping options;
+	// the cheapest is used when it is empty.
+	ShippingMethod string `json:"shipping_method"`
+
+	// Each address is either given inline or, for logged-in customers, as
+	// the id of a saved address. The billing address defaults to shipping.
+	ShippingAddress   *models.Address `json:"shipping_address"`
+	ShippingAddressID string          `json:"shipping_address_id"`
+	BillingAddress    *models.Address `json:"billing_address"`
+	BillingAddressID  string          `json:"billing_address_id"`
 }
 
 type CheckoutResponse struct {
 	OrderID    string `json:"order_id"`
 	TotalCents int    `json:"total_cents"`
 	Currency   string `json:"currency"`
+
+	// AccessToken lets guests view the order via GET /api/orders/:id.
+	AccessToken          string    `json:"access_token"`
+	AccessTokenExpiresAt time.Time `json:"access_token_expires_at"`
 }
 
 func (h *CheckoutHandler) CreateOrder(c *fiber.Ctx) error {
@@ -37,8 +72,29 @@ func (h *CheckoutHandler) CreateOrder(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
 	}
 
-	if len(req.Items) == 0 {
-		return c.Status(400).JSON(fiber.Map{"error": "items required"})
+	// Orders placed with a customer token are linked to the account; guests
+	// are identified by email only.
+	customerID, err := optionalCustomerID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	if claims := middleware.CustomerFromContext(c); claims != nil && strings.TrimSpace(req.CustomerEmail) == "" {
+		req.CustomerEmail = claims.Email
+	}
+
+	shippingAddress, ferr := h.resolveAddress(c, customerID, "shipping_address", req.ShippingAddress, req.ShippingAddressID)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
+	if shippingAddress == nil {
+		return c.Status(400).JSON(fiber.Map{"error": "shipping_address required"})
+	}
+	billingAddress, ferr := h.resolveAddress(c, customerID, "billing_address", req.BillingAddress, req.BillingAddressID)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
+	if billingAddress == nil {
+		billingAddress = shippingAddress
 	}
 
 	tx, err := h.DB.Begin(c.Context())
@@ -47,96 +103,275 @@ func (h *CheckoutHandler) CreateOrder(c *fiber.Ctx) error {
 	}
 	defer tx.Rollback(c.Context())
 
-	subtotalCents := 0
-	orderItems := []struct {
-		productID uuid.UUID
-		name      string
-		price     int
-		qty       int
-	}{}
-
-	for _, item := range req.Items {
-		productUUID, err := uuid.Parse(item.ProductID)
-		if err != nil {
-			return c.Status(400).JSON(fiber.Map{"error": "invalid product id"})
-		}
+	rates, err := exchangeRates(c.Context(), tx)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch exchange rates"})
+	}
+	if req.Currency, ferr = supportedCurrency(rates, req.Currency); ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
 
-		var product models.Product
-		err = tx.QueryRow(
-			c.Context(),
-			`SELECT id, name, price_cents, stock FROM products WHERE id = $1 FOR UPDATE`,
-			productUUID,
-		).Scan(&product.ID, &product.Name, &product.PriceCents, &product.Stock)
-		if err != nil {
-			return c.Status(404).JSON(fiber.Map{"error": "product not found"})
-		}
+	items, cartID, ferr := checkoutItems(c, tx, &req, customerID, true)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
 
-		if product.Stock < item.Qty {
-			return c.Status(400).JSON(fiber.Map{"error": "insufficient stock"})
-		}
+	lines, cur, ferr := pricingLines(c.Context(), tx, items, rates, req.Currency, true)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
 
-		itemTotal := product.PriceCents * item.Qty
-		subtotalCents += itemTotal
-
-		orderItems = append(orderItems, struct {
-			productID uuid.UUID
-			name      string
-			price     int
-			qty       int
-		}{
-			productID: product.ID,
-			name:      product.Name,
-			price:     product.PriceCents,
-			qty:       item.Qty,
-		})
+	shippingOption, _, ferr := checkoutShipping(c.Context(), tx, lines, rates, cur, shippingAddress.Country, req.ShippingMethod, true)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
 
-		_, err = tx.Exec(
-			c.Context(),
-			`UPDATE products SET stock = stock - $1 WHERE id = $2`,
-			item.Qty, product.ID,
-		)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "failed to update stock"})
+	var promo *pricing.Promotion
+	if strings.TrimSpace(req.PromoCode) != "" {
+		promo, ferr = checkoutPromotion(c.Context(), tx, req.PromoCode, customerID, req.CustomerEmail, true)
+		if ferr != nil {
+			return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+		}
+		if customerID == nil && strings.TrimSpace(req.CustomerEmail) == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "customer_email is required to use a promo code"})
+		}
+		if !localizePromotion(promo, rates, cur) {
+			return c.Status(400).JSON(fiber.Map{"error": "promo code is not available in " + strings.ToUpper(cur)})
 		}
 	}
 
-	shippingCents := 0
-	if subtotalCents < 5000 {
-		shippingCents = 500
+	taxes, err := taxCalculator(c.Context(), tx, shippingAddress.Country, shippingAddress.Region)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch tax rates"})
+	}
+
+	quote, err := pricing.Calculate(pricing.Request{
+		Lines:     lines,
+		Currency:  cur,
+		Shipping:  shippingOption,
+		Promotion: promo,
+		Tax:       taxes,
+		Country:   shippingAddress.Country,
+		Region:    shippingAddress.Region,
+	})
+	if err != nil {
+		ferr := pricingError(err)
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
 	}
-	totalCents := subtotalCents + shippingCents
 
 	var orderID uuid.UUID
 	err = tx.QueryRow(
 		c.Context(),
-		`INSERT INTO orders (customer_email, status, subtotal_cents, shipping_cents, total_cents, currency) 
-		 VALUES ($1, $2, $3, $4, $5, $6) 
+		`INSERT INTO orders (customer_id, customer_email, status, subtotal_cents, shipping_cents, shipping_method, shipping_method_name, discount_cents, tax_cents, shipping_tax_cents, rounding_cents, total_cents, currency) 
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) 
 		 RETURNING id`,
-		req.CustomerEmail, "pending", subtotalCents, shippingCents, totalCents, "usd",
+		customerID, req.CustomerEmail, "pending", quote.SubtotalCents, quote.ShippingCents, shippingOption.Code, shippingOption.Name,
+		quote.DiscountCents, quote.TaxCents, quote.ShippingTaxCents, quote.RoundingCents, quote.TotalCents, quote.Currency,
 	).Scan(&orderID)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "failed to create order"})
 	}
 
-	for _, item := range orderItems {
+	for _, line := range quote.Lines {
 		_, err = tx.Exec(
 			c.Context(),
-			`INSERT INTO order_items (order_id, product_id, name_snapshot, price_cents_snapshot, qty) 
-			 VALUES ($1, $2, $3, $4, $5)`,
-			orderID, item.productID, item.name, item.price, item.qty,
+			`INSERT INTO order_items (order_id, product_id, variant_id, sku, variant_options, name_snapshot, price_cents_snapshot, qty, tax_class, tax_cents) 
+			 VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8, $9, $10)`,
+			orderID, line.ProductID, line.VariantID, line.SKU, variantOptionsJSON(line.VariantOptions),
+			line.Name, line.UnitPriceCents, line.Qty, line.TaxClass, line.TaxCents,
 		)
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{"error": "failed to create order items"})
 		}
 	}
 
+	if quote.Promotion != nil {
+		if err = insertOrderPromotion(c.Context(), tx, orderID, quote.Promotion); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to save promotion"})
+		}
+	}
+
+	if err = insertOrderTaxLines(c.Context(), tx, orderID, quote.TaxLines); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to save tax lines"})
+	}
+
+	reserved := make([]inventory.Item, 0, len(lines))
+	for _, line := range lines {
+		reserved = append(reserved, inventory.Item{ProductID: line.ProductID, VariantID: line.VariantID, Qty: line.Qty})
+	}
+	if err = inventory.Reserve(c.Context(), tx, orderID, reserved); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to update stock"})
+	}
+
+	if err = insertOrderAddress(c.Context(), tx, orderID, models.AddressTypeShipping, *shippingAddress); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to save shipping address"})
+	}
+	if err = insertOrderAddress(c.Context(), tx, orderID, models.AddressTypeBilling, *billingAddress); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to save billing address"})
+	}
+
+	if cartID != uuid.Nil {
+		_, err = tx.Exec(
+			c.Context(),
+			`UPDATE carts SET converted_at = CURRENT_TIMESTAMP, order_id = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1`,
+			cartID, orderID,
+		)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to close cart"})
+		}
+	}
+
+	accessToken, accessExpiresAt, err := middleware.GenerateOrderAccessToken(orderID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to issue order token"})
+	}
+
+	resp := CheckoutResponse{
+		OrderID:    orderID.String(),
+		TotalCents: quote.TotalCents,
+		Currency:   quote.Currency,
+
+		AccessToken:          accessToken,
+		AccessTokenExpiresAt: accessExpiresAt,
+	}
+
+	// The response is stored with the order so that a retry can never
+	// create a second one.
+	if err = middleware.StoreIdempotentResponse(c, tx, resp); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to store response"})
+	}
+
 	if err = tx.Commit(c.Context()); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
 	}
 
-	return c.JSON(CheckoutResponse{
-		OrderID:    orderID.String(),
-		TotalCents: totalCents,
-		Currency:   "usd",
+	return c.JSON(resp)
+}
+
+// QuoteResponse is the quote plus every shipping option the client can
+// choose from with shipping_method.
+type QuoteResponse struct {
+	pricing.Quote
+	ShippingOptions []shipping.Option `json:"shipping_options"`
+}
+
+// Quote prices the same items or cart as CreateOrder would, without
+// reserving stock or creating an order. The shipping address is optional;
+// without one, methods priced by destination may not be offered yet.
+func (h *CheckoutHandler) Quote(c *fiber.Ctx) error {
+	var req CheckoutRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+
+	customerID, err := optionalCustomerID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	rates, err := exchangeRates(c.Context(), h.DB)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch exchange rates"})
+	}
+	var ferr *fiber.Error
+	if req.Currency, ferr = supportedCurrency(rates, req.Currency); ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
+
+	items, _, ferr := checkoutItems(c, h.DB, &req, customerID, false)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
+
+	lines, cur, ferr := pricingLines(c.Context(), h.DB, items, rates, req.Currency, false)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
+
+	shippingAddress, ferr := h.resolveAddress(c, customerID, "shipping_address", req.ShippingAddress, req.ShippingAddressID)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
+	var destination models.Address
+	if shippingAddress != nil {
+		destination = *shippingAddress
+	}
+	shippingOption, shippingOptions, ferr := checkoutShipping(c.Context(), h.DB, lines, rates, cur, destination.Country, req.ShippingMethod, false)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
+
+	// Tax depends on the destination, so it is only quoted with an address.
+	var taxes tax.TaxCalculator
+	if shippingAddress != nil {
+		if taxes, err = taxCalculator(c.Context(), h.DB, destination.Country, destination.Region); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to fetch tax rates"})
+		}
+	}
+
+	var promo *pricing.Promotion
+	if strings.TrimSpace(req.PromoCode) != "" {
+		email := req.CustomerEmail
+		if claims := middleware.CustomerFromContext(c); claims != nil && strings.TrimSpace(email) == "" {
+			email = claims.Email
+		}
+		promo, ferr = checkoutPromotion(c.Context(), h.DB, req.PromoCode, customerID, email, false)
+		if ferr != nil {
+			return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+		}
+		if !localizePromotion(promo, rates, cur) {
+			return c.Status(400).JSON(fiber.Map{"error": "promo code is not available in " + strings.ToUpper(cur)})
+		}
+	}
+
+	quote, err := pricing.Calculate(pricing.Request{
+		Lines:     lines,
+		Currency:  cur,
+		Shipping:  shippingOption,
+		Promotion: promo,
+		Tax:       taxes,
+		Country:   destination.Country,
+		Region:    destination.Region,
 	})
+	if err != nil {
+		ferr := pricingError(err)
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
+
+	return c.JSON(QuoteResponse{Quote: quote, ShippingOptions: shippingOptions})
+}
+
+// resolveAddress returns the validated inline address or the saved address
+// referenced by savedID, or nil when neither was sent.
+func (h *CheckoutHandler) resolveAddress(c *fiber.Ctx, customerID *uuid.UUID, field string, inline *models.Address, savedID string) (*models.Address, *fiber.Error) {
+	if savedID != "" {
+		if customerID == nil {
+			return nil, fiber.NewError(401, field+"_id requires a customer token")
+		}
+		addressUUID, err := uuid.Parse(savedID)
+		if err != nil {
+			return nil, fiber.NewError(400, "invalid "+field+"_id")
+		}
+		address, err := loadCustomerAddress(c.Context(), h.DB, *customerID, addressUUID)
+		if errors.Is(err, errAddressNotFound) {
+			return nil, fiber.NewError(400, field+"_id: address not found")
+		}
+		if err != nil {
+			return nil, fiber.NewError(500, "failed to load address")
+		}
+		// Saved addresses are checked again so that ones saved before the
+		// current rules are normalized, or rejected, before pricing tax.
+		if msg := validateAddress(&address); msg != "" {
+			return nil, fiber.NewError(400, field+"_id: "+msg)
+		}
+		return &address, nil
+	}
+
+	if inline == nil {
+		return nil, nil
+	}
+	if msg := validateAddress(inline); msg != "" {
+		return nil, fiber.NewError(400, field+": "+msg)
+	}
+	return inline, nil
 }
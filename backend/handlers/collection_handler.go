@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/Biz0n58/Zaria/backend/middleware"
+	"github.com/Biz0n58/Zaria/backend/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type CollectionHandler struct {
+	DB *pgxpool.Pool
+}
+
+func NewCollectionHandler(db *pgxpool.Pool) *CollectionHandler {
+	return &CollectionHandler{DB: db}
+}
+
+type CollectionRequest struct {
+	Name        string                  `json:"name"`
+	Slug        string                  `json:"slug"`
+	Description string                  `json:"description"`
+	Type        string                  `json:"type"`
+	Rules       []models.CollectionRule `json:"rules"`
+	// ProductIDs are the products of a manual collection, in order.
+	ProductIDs []string `json:"product_ids"`
+	IsActive   bool     `json:"is_active"`
+	Position   int      `json:"position"`
+}
+
+type CollectionsResponse struct {
+	Collections []models.Collection `json:"collections"`
+}
+
+// GetActiveCollections lists the collections shown in the storefront; their
+// products are fetched with /api/products?collection=slug.
+func (h *CollectionHandler) GetActiveCollections(c *fiber.Ctx) error {
+	return h.list(c, true)
+}
+
+func (h *CollectionHandler) ListCollections(c *fiber.Ctx) error {
+	return h.list(c, false)
+}
+
+func (h *CollectionHandler) list(c *fiber.Ctx, activeOnly bool) error {
+	query := `SELECT ` + collectionColumns + ` FROM collections`
+	if activeOnly {
+		query += ` WHERE is_active = true`
+	}
+	query += ` ORDER BY position, name`
+
+	rows, err := h.DB.Query(c.Context(), query)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch collections"})
+	}
+	defer rows.Close()
+
+	collections := []models.Collection{}
+	for rows.Next() {
+		var col models.Collection
+		if err := scanCollection(rows, &col); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to scan collection"})
+		}
+		collections = append(collections, col)
+	}
+
+	return c.JSON(CollectionsResponse{Collections: collections})
+}
+
+func (h *CollectionHandler) GetCollection(c *fiber.Ctx) error {
+	collectionUUID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid collection id"})
+	}
+
+	col, err := loadCollection(c.Context(), h.DB, collectionUUID, false)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "collection not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch collection"})
+	}
+
+	return c.JSON(col)
+}
+
+func (h *CollectionHandler) CreateCollection(c *fiber.Ctx) error {
+	var req CollectionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+	productIDs, msg := validateCollectionRequest(&req)
+	if msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+	}
+	defer tx.Rollback(c.Context())
+
+	var collectionID uuid.UUID
+	err = tx.QueryRow(
+		c.Context(),
+		`INSERT INTO collections (name, slug, description, type, rules, is_active, position)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 RETURNING id`,
+		req.Name, req.Slug, req.Description, req.Type, req.Rules, req.IsActive, req.Position,
+	).Scan(&collectionID)
+	if err != nil {
+		return collectionWriteError(c, err, "failed to create collection")
+	}
+
+	if err := replaceCollectionProducts(c.Context(), tx, collectionID, productIDs); err != nil {
+		return collectionWriteError(c, err, "failed to create collection")
+	}
+
+	col, err := loadCollection(c.Context(), tx, collectionID, false)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch collection"})
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+	}
+
+	middleware.SetAudit(c, "", "collection", col.ID.String(), nil, col)
+
+	return c.Status(201).JSON(col)
+}
+
+func (h *CollectionHandler) UpdateCollection(c *fiber.Ctx) error {
+	collectionUUID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid collection id"})
+	}
+
+	var req CollectionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+	productIDs, msg := validateCollectionRequest(&req)
+	if msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+	}
+	defer tx.Rollback(c.Context())
+
+	before, err := loadCollection(c.Context(), tx, collectionUUID, true)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "collection not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch collection"})
+	}
+
+	_, err = tx.Exec(
+		c.Context(),
+		`UPDATE collections
+		 SET name = $1, slug = $2, description = $3, type = $4, rules = $5, is_active = $6, position = $7,
+		   updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $8`,
+		req.Name, req.Slug, req.Description, req.Type, req.Rules, req.IsActive, req.Position, collectionUUID,
+	)
+	if err != nil {
+		return collectionWriteError(c, err, "failed to update collection")
+	}
+
+	if err := replaceCollectionProducts(c.Context(), tx, collectionUUID, productIDs); err != nil {
+		return collectionWriteError(c, err, "failed to update collection")
+	}
+
+	col, err := loadCollection(c.Context(), tx, collectionUUID, false)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch collection"})
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+	}
+
+	middleware.SetAudit(c, "", "collection", col.ID.String(), before, col)
+
+	return c.JSON(col)
+}
+
+func (h *CollectionHandler) DeleteCollection(c *fiber.Ctx) error {
+	collectionUUID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid collection id"})
+	}
+
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+	}
+	defer tx.Rollback(c.Context())
+
+	before, err := loadCollection(c.Context(), tx, collectionUUID, true)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "collection not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch collection"})
+	}
+
+	if _, err := tx.Exec(c.Context(), `DELETE FROM collections WHERE id = $1`, collectionUUID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to delete collection"})
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+	}
+
+	middleware.SetAudit(c, "", "collection", before.ID.String(), before, nil)
+
+	return c.JSON(fiber.Map{"message": "collection deleted"})
+}
+
+func loadCollection(ctx context.Context, db querier, id uuid.UUID, lock bool) (models.Collection, error) {
+	query := `SELECT ` + collectionColumns + ` FROM collections WHERE id = $1`
+	if lock {
+		query += ` FOR UPDATE`
+	}
+
+	var col models.Collection
+	err := scanCollection(db.QueryRow(ctx, query, id), &col)
+	return col, err
+}
+
+// validateCollectionRequest normalizes req and returns the products of a
+// manual collection, or a message describing the first problem. Manual
+// collections have no rules and rule collections no products.
+func validateCollectionRequest(req *CollectionRequest) ([]uuid.UUID, string) {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return nil, "name is required"
+	}
+	req.Slug = strings.ToLower(strings.TrimSpace(req.Slug))
+	if !slugPattern.MatchString(req.Slug) || len(req.Slug) > 255 {
+		return nil, "slug must be lowercase letters and digits separated by '-'"
+	}
+
+	productIDs, err := parseUUIDs(req.ProductIDs)
+	if err != nil {
+		return nil, "invalid product id"
+	}
+
+	switch req.Type {
+	case models.CollectionTypeManual:
+		if len(req.Rules) > 0 {
+			return nil, "manual collections have no rules"
+		}
+	case models.CollectionTypeRule:
+		if len(productIDs) > 0 {
+			return nil, "rule collections have no product_ids"
+		}
+		if len(req.Rules) == 0 {
+			return nil, "rule collections need at least one rule"
+		}
+		if msg := validateCollectionRules(req.Rules); msg != "" {
+			return nil, msg
+		}
+	default:
+		return nil, "type must be manual or rule"
+	}
+	if req.Rules == nil {
+		req.Rules = []models.CollectionRule{}
+	}
+
+	return productIDs, ""
+}
+
+func replaceCollectionProducts(ctx context.Context, db querier, collectionID uuid.UUID, productIDs []uuid.UUID) error {
+	if _, err := db.Exec(ctx, `DELETE FROM collection_products WHERE collection_id = $1`, collectionID); err != nil {
+		return err
+	}
+	for i, id := range productIDs {
+		_, err := db.Exec(
+			ctx,
+			`INSERT INTO collection_products (collection_id, product_id, position) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`,
+			collectionID, id, i,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func collectionWriteError(c *fiber.Ctx, err error, fallback string) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "23505":
+			return c.Status(409).JSON(fiber.Map{"error": "a collection with this slug already exists"})
+		case "23503":
+			return c.Status(400).JSON(fiber.Map{"error": "unknown product id"})
+		}
+	}
+	return c.Status(500).JSON(fiber.Map{"error": fallback})
+}
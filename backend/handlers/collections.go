@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"context"
+	"math"
+	"strings"
+
+	"github.com/Biz0n58/Zaria/backend/currency"
+	"github.com/Biz0n58/Zaria/backend/models"
+	"github.com/jackc/pgx/v5"
+)
+
+const collectionColumns = `id, name, slug, description, type, rules,
+	ARRAY(SELECT product_id::text FROM collection_products WHERE collection_id = collections.id ORDER BY position, product_id),
+	is_active, position, created_at, updated_at`
+
+func scanCollection(row pgx.Row, col *models.Collection) error {
+	var productIDs []string
+	err := row.Scan(
+		&col.ID, &col.Name, &col.Slug, &col.Description, &col.Type, &col.Rules,
+		&productIDs, &col.IsActive, &col.Position, &col.CreatedAt, &col.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	col.ProductIDs, err = parseUUIDs(productIDs)
+	return err
+}
+
+func loadCollectionBySlug(ctx context.Context, db querier, slug string) (models.Collection, error) {
+	var col models.Collection
+	err := scanCollection(db.QueryRow(ctx, `SELECT `+collectionColumns+` FROM collections WHERE slug = $1`, slug), &col)
+	return col, err
+}
+
+// productStockSQL is the stock a product can be sold from: the stock of its
+// active variants when it has variants, its own stock otherwise.
+const productStockSQL = `CASE WHEN EXISTS (SELECT 1 FROM product_variants WHERE product_id = products.id)
+	  THEN (SELECT COALESCE(SUM(stock), 0) FROM product_variants WHERE product_id = products.id AND is_active)
+	  ELSE stock END`
+
+const (
+	ruleNumber = iota
+	rulePrice
+	ruleText
+	ruleCategory
+)
+
+// collectionRuleFields are the product fields collection rules can test,
+// with the SQL for each. Prices are compared in the base currency, since
+// products are priced in different currencies.
+var collectionRuleFields = map[string]struct {
+	kind int
+	sql  string
+}{
+	"price_cents":  {rulePrice, ``},
+	"stock":        {ruleNumber, productStockSQL},
+	"weight_grams": {ruleNumber, `weight_grams`},
+	"name":         {ruleText, `name`},
+	"category":     {ruleCategory, ``},
+}
+
+var ruleComparisons = map[string]string{
+	"eq": "=", "neq": "<>", "lt": "<", "lte": "<=", "gt": ">", "gte": ">=",
+}
+
+// validateCollectionRules checks every rule and normalizes numeric values to
+// integers. It returns a message describing the first problem, or "".
+func validateCollectionRules(rules []models.CollectionRule) string {
+	for i, rule := range rules {
+		field, ok := collectionRuleFields[rule.Field]
+		if !ok {
+			return "rule field must be price_cents, stock, weight_grams, name or category"
+		}
+		switch field.kind {
+		case ruleNumber, rulePrice:
+			if _, ok := ruleComparisons[rule.Operator]; !ok {
+				return rule.Field + " rules need operator eq, neq, lt, lte, gt or gte"
+			}
+			n, ok := ruleInt(rule.Value)
+			if !ok {
+				return rule.Field + " rules need an integer value"
+			}
+			rules[i].Value = n
+		case ruleText:
+			if rule.Operator != "eq" && rule.Operator != "neq" && rule.Operator != "contains" {
+				return rule.Field + " rules need operator eq, neq or contains"
+			}
+			if s, ok := rule.Value.(string); !ok || s == "" {
+				return rule.Field + " rules need a text value"
+			}
+		case ruleCategory:
+			if rule.Operator != "eq" {
+				return "category rules need operator eq"
+			}
+			if s, ok := rule.Value.(string); !ok || !slugPattern.MatchString(s) {
+				return "category rules need a category slug"
+			}
+		}
+	}
+	return ""
+}
+
+// ruleInt accepts the integer values JSON decoding produces.
+func ruleInt(v any) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case float64:
+		if n != math.Trunc(n) || math.Abs(n) > math.MaxInt32 {
+			return 0, false
+		}
+		return int(n), true
+	}
+	return 0, false
+}
+
+// collectionCondition restricts a products query to the products of col.
+// rates convert prices for price rules.
+func collectionCondition(col models.Collection, rates currency.Rates) sqlFragment {
+	return func(args *sqlArgs) string {
+		if col.Type == models.CollectionTypeManual {
+			return `id IN (SELECT product_id FROM collection_products WHERE collection_id = ` + args.add(col.ID) + `)`
+		}
+
+		parts := make([]string, 0, len(col.Rules))
+		for _, rule := range col.Rules {
+			parts = append(parts, collectionRuleSQL(args, rule, rates))
+		}
+		if len(parts) == 0 {
+			return `false`
+		}
+		return strings.Join(parts, ` AND `)
+	}
+}
+
+// collectionRuleSQL renders one rule; rules that no longer validate match
+// nothing.
+func collectionRuleSQL(args *sqlArgs, rule models.CollectionRule, rates currency.Rates) string {
+	field, ok := collectionRuleFields[rule.Field]
+	if !ok {
+		return `false`
+	}
+	switch field.kind {
+	case ruleNumber:
+		op, ok := ruleComparisons[rule.Operator]
+		n, valid := ruleInt(rule.Value)
+		if !ok || !valid {
+			return `false`
+		}
+		return `(` + field.sql + `) ` + op + ` ` + args.add(n)
+	case rulePrice:
+		op, ok := ruleComparisons[rule.Operator]
+		n, valid := ruleInt(rule.Value)
+		if !ok || !valid {
+			return `false`
+		}
+		return `(` + listingPriceSQL(args, rates, rates.Base) + `) ` + op + ` ` + args.add(n)
+	case ruleText:
+		s, _ := rule.Value.(string)
+		switch rule.Operator {
+		case "eq":
+			return `LOWER(` + field.sql + `) = LOWER(` + args.add(s) + `)`
+		case "neq":
+			return `LOWER(` + field.sql + `) <> LOWER(` + args.add(s) + `)`
+		case "contains":
+			return field.sql + ` ILIKE ` + args.add("%"+s+"%")
+		}
+	case ruleCategory:
+		s, _ := rule.Value.(string)
+		return productInCategorySQL(args.add(s))
+	}
+	return `false`
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Biz0n58/Zaria/backend/currency"
+	"github.com/Biz0n58/Zaria/backend/models"
+	"github.com/Biz0n58/Zaria/backend/pricing"
+	"github.com/gofiber/fiber/v2"
+)
+
+// exchangeRates loads the admin-managed rates from the base currency.
+func exchangeRates(ctx context.Context, db querier) (currency.Rates, error) {
+	rates := currency.Rates{Base: pricing.DefaultCurrency, Rates: map[string]float64{}}
+
+	rows, err := db.Query(ctx, `SELECT currency, rate::float8 FROM exchange_rates`)
+	if err != nil {
+		return rates, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var code string
+		var rate float64
+		if err := rows.Scan(&code, &rate); err != nil {
+			return rates, err
+		}
+		rates.Rates[code] = rate
+	}
+	return rates, rows.Err()
+}
+
+// supportedCurrency normalizes a currency sent by a client. Only the base
+// currency and currencies with an exchange rate are accepted; "" is
+// returned unchanged.
+func supportedCurrency(rates currency.Rates, code string) (string, *fiber.Error) {
+	code = currency.Normalize(code)
+	if code == "" {
+		return "", nil
+	}
+	if !currency.Valid(code) || !rates.Supports(code) {
+		return "", fiber.NewError(400, "unsupported currency "+strings.ToUpper(code))
+	}
+	return code, nil
+}
+
+// catalogCurrency reads the ?currency= of a catalog request, with the rates
+// to price products in it. Without the parameter products keep their own
+// currency.
+func catalogCurrency(c *fiber.Ctx, db querier) (string, currency.Rates, *fiber.Error) {
+	if c.Query("currency") == "" {
+		return "", currency.Rates{}, nil
+	}
+	rates, err := exchangeRates(c.Context(), db)
+	if err != nil {
+		return "", rates, fiber.NewError(500, "failed to fetch exchange rates")
+	}
+	target, ferr := supportedCurrency(rates, c.Query("currency"))
+	return target, rates, ferr
+}
+
+// localPrice returns a product's price in target: its own price, its
+// explicit price in target, or its own price converted with rates.
+func localPrice(rates currency.Rates, priceCents int, productCurrency string, explicit *int, target string) (int, bool) {
+	if productCurrency == target {
+		return priceCents, true
+	}
+	if explicit != nil {
+		return *explicit, true
+	}
+	return rates.Convert(priceCents, productCurrency, target)
+}
+
+// localizeProduct replaces the product's price, and the price overrides of
+// its variants, with their prices in target. It reports false, leaving the
+// product unchanged, when the product cannot be priced in target.
+func localizeProduct(p *models.Product, rates currency.Rates, target string) bool {
+	var explicit *int
+	for _, price := range p.Prices {
+		if price.Currency == target {
+			cents := price.PriceCents
+			explicit = &cents
+			break
+		}
+	}
+
+	cents, ok := localPrice(rates, p.PriceCents, p.Currency, explicit, target)
+	if !ok {
+		return false
+	}
+
+	variantCents := make([]*int, len(p.Variants))
+	for i, v := range p.Variants {
+		if v.PriceCents == nil {
+			continue
+		}
+		converted, ok := localPrice(rates, *v.PriceCents, p.Currency, nil, target)
+		if !ok {
+			return false
+		}
+		variantCents[i] = &converted
+	}
+
+	p.PriceCents = cents
+	p.Currency = target
+	for i := range p.Variants {
+		p.Variants[i].PriceCents = variantCents[i]
+	}
+	return true
+}
+
+// localizePromotion converts the amounts of a promotion, which are
+// configured in the base currency, into target.
+func localizePromotion(p *pricing.Promotion, rates currency.Rates, target string) bool {
+	minSubtotal, ok := rates.Convert(p.MinSubtotalCents, rates.Base, target)
+	if !ok {
+		return false
+	}
+	p.MinSubtotalCents = minSubtotal
+
+	if p.Type == pricing.PromotionFixedAmount {
+		value, ok := rates.Convert(p.Value, rates.Base, target)
+		if !ok {
+			return false
+		}
+		p.Value = value
+	}
+	return true
+}
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Biz0n58/Zaria/backend/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+type AddressRequest struct {
+	Label string `json:"label"`
+	models.Address
+	IsDefault bool `json:"is_default"`
+}
+
+func (h *CustomerHandler) ListAddresses(c *fiber.Ctx) error {
+	customerUUID, err := currentCustomerID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	rows, err := h.DB.Query(
+		c.Context(),
+		`SELECT `+customerAddressColumns+` FROM customer_addresses
+		 WHERE customer_id = $1 ORDER BY is_default DESC, created_at`,
+		customerUUID,
+	)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch addresses"})
+	}
+	defer rows.Close()
+
+	addresses := []models.CustomerAddress{}
+	for rows.Next() {
+		var a models.CustomerAddress
+		if err := scanCustomerAddress(rows, &a); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to scan address"})
+		}
+		addresses = append(addresses, a)
+	}
+
+	return c.JSON(addresses)
+}
+
+func (h *CustomerHandler) CreateAddress(c *fiber.Ctx) error {
+	customerUUID, err := currentCustomerID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	var req AddressRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+	if msg := validateAddress(&req.Address); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+	if utf8.RuneCountInString(strings.TrimSpace(req.Label)) > 100 {
+		return c.Status(400).JSON(fiber.Map{"error": "label must be at most 100 characters"})
+	}
+
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+	}
+	defer tx.Rollback(c.Context())
+
+	// The first saved address becomes the default.
+	var count int
+	if err := tx.QueryRow(
+		c.Context(),
+		`SELECT COUNT(*) FROM customer_addresses WHERE customer_id = $1`,
+		customerUUID,
+	).Scan(&count); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to create address"})
+	}
+	isDefault := req.IsDefault || count == 0
+
+	if isDefault {
+		if err := clearDefaultAddress(c.Context(), tx, customerUUID); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to create address"})
+		}
+	}
+
+	var address models.CustomerAddress
+	a := req.Address
+	err = scanCustomerAddress(tx.QueryRow(
+		c.Context(),
+		`INSERT INTO customer_addresses (customer_id, label, name, line1, line2, city, region, postal_code, country, phone, is_default)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		 RETURNING `+customerAddressColumns,
+		customerUUID, strings.TrimSpace(req.Label), a.Name, a.Line1, a.Line2, a.City, a.Region, a.PostalCode, a.Country, a.Phone, isDefault,
+	), &address)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to create address"})
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+	}
+
+	return c.Status(201).JSON(address)
+}
+
+func (h *CustomerHandler) UpdateAddress(c *fiber.Ctx) error {
+	customerUUID, err := currentCustomerID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	addressUUID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid address id"})
+	}
+
+	var req AddressRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+	if msg := validateAddress(&req.Address); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+	if utf8.RuneCountInString(strings.TrimSpace(req.Label)) > 100 {
+		return c.Status(400).JSON(fiber.Map{"error": "label must be at most 100 characters"})
+	}
+
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+	}
+	defer tx.Rollback(c.Context())
+
+	if req.IsDefault {
+		if err := clearDefaultAddress(c.Context(), tx, customerUUID); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to update address"})
+		}
+	}
+
+	// Unsetting is_default on the current default is ignored so the customer
+	// always keeps one default address.
+	var address models.CustomerAddress
+	a := req.Address
+	err = scanCustomerAddress(tx.QueryRow(
+		c.Context(),
+		`UPDATE customer_addresses SET
+		   label = $3, name = $4, line1 = $5, line2 = $6, city = $7, region = $8,
+		   postal_code = $9, country = $10, phone = $11,
+		   is_default = is_default OR $12,
+		   updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $1 AND customer_id = $2
+		 RETURNING `+customerAddressColumns,
+		addressUUID, customerUUID, strings.TrimSpace(req.Label), a.Name, a.Line1, a.Line2, a.City, a.Region, a.PostalCode, a.Country, a.Phone, req.IsDefault,
+	), &address)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "address not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "failed to update address"})
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+	}
+
+	return c.JSON(address)
+}
+
+func (h *CustomerHandler) DeleteAddress(c *fiber.Ctx) error {
+	customerUUID, err := currentCustomerID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	addressUUID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid address id"})
+	}
+
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+	}
+	defer tx.Rollback(c.Context())
+
+	var wasDefault bool
+	err = tx.QueryRow(
+		c.Context(),
+		`DELETE FROM customer_addresses WHERE id = $1 AND customer_id = $2 RETURNING is_default`,
+		addressUUID, customerUUID,
+	).Scan(&wasDefault)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "address not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "failed to delete address"})
+	}
+
+	// Promote the oldest remaining address when the default was removed.
+	if wasDefault {
+		_, err = tx.Exec(
+			c.Context(),
+			`UPDATE customer_addresses SET is_default = true, updated_at = CURRENT_TIMESTAMP
+			 WHERE id = (SELECT id FROM customer_addresses WHERE customer_id = $1 ORDER BY created_at LIMIT 1)`,
+			customerUUID,
+		)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to delete address"})
+		}
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+	}
+
+	return c.JSON(fiber.Map{"message": "address deleted"})
+}
+
+func clearDefaultAddress(ctx context.Context, db querier, customerID uuid.UUID) error {
+	_, err := db.Exec(
+		ctx,
+		`UPDATE customer_addresses SET is_default = false, updated_at = CURRENT_TIMESTAMP
+		 WHERE customer_id = $1 AND is_default`,
+		customerID,
+	)
+	return err
+}
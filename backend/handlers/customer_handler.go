@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Biz0n58/Zaria/backend/mailer"
+	"github.com/Biz0n58/Zaria/backend/middleware"
+	"github.com/Biz0n58/Zaria/backend/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type CustomerHandler struct {
+	DB     *pgxpool.Pool
+	Mailer mailer.Mailer
+}
+
+func NewCustomerHandler(db *pgxpool.Pool, m mailer.Mailer) *CustomerHandler {
+	return &CustomerHandler{DB: db, Mailer: m}
+}
+
+const customerColumns = `id, email, password_hash, name, email_verified_at, token_version, created_at, updated_at`
+
+func scanCustomer(row pgx.Row, cu *models.Customer) error {
+	return row.Scan(&cu.ID, &cu.Email, &cu.PasswordHash, &cu.Name, &cu.EmailVerifiedAt, &cu.TokenVersion, &cu.CreatedAt, &cu.UpdatedAt)
+}
+
+// AuthResponse matches the shape expected by the mobile client.
+type AuthResponse struct {
+	Token     string          `json:"token"`
+	ExpiresAt time.Time       `json:"expires_at"`
+	User      models.Customer `json:"user"`
+}
+
+type RegisterRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Name     string `json:"name"`
+}
+
+func (h *CustomerHandler) Register(c *fiber.Ctx) error {
+	var req RegisterRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if _, err := mail.ParseAddress(email); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "valid email is required"})
+	}
+	if len(req.Password) < minPasswordLength {
+		return c.Status(400).JSON(fiber.Map{"error": "password must be at least 8 characters"})
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to hash password"})
+	}
+
+	var customer models.Customer
+	err = scanCustomer(h.DB.QueryRow(
+		c.Context(),
+		`INSERT INTO customers (email, password_hash, name) VALUES ($1, $2, $3) RETURNING `+customerColumns,
+		email, string(hash), strings.TrimSpace(req.Name),
+	), &customer)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return c.Status(409).JSON(fiber.Map{"error": "an account with this email already exists"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "failed to create account"})
+	}
+
+	// The account is usable straight away; verification is best effort.
+	if err := h.sendVerificationEmail(c.Context(), customer); err != nil {
+		log.Println("customer: failed to send verification email:", err)
+	}
+
+	h.mergeGuestCart(c, customer.ID)
+
+	return h.respondWithToken(c, 201, customer)
+}
+
+func (h *CustomerHandler) Login(c *fiber.Ctx) error {
+	var req LoginRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if email == "" || req.Password == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "email and password are required"})
+	}
+
+	retryAfter, err := loginRetryAfter(c.Context(), h.DB, customerLoginScopes, c.IP(), email)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to check login attempts"})
+	}
+	if retryAfter > 0 {
+		return tooManyAttempts(c, retryAfter)
+	}
+
+	var customer models.Customer
+	err = scanCustomer(h.DB.QueryRow(
+		c.Context(),
+		`SELECT `+customerColumns+` FROM customers WHERE email = $1`,
+		email,
+	), &customer)
+	if err != nil {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(req.Password))
+		_ = recordLoginFailure(c.Context(), h.DB, customerLoginScopes, c.IP(), email, nil)
+		return c.Status(401).JSON(fiber.Map{"error": "invalid email or password"})
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(customer.PasswordHash), []byte(req.Password)); err != nil {
+		_ = recordLoginFailure(c.Context(), h.DB, customerLoginScopes, c.IP(), email, nil)
+		return c.Status(401).JSON(fiber.Map{"error": "invalid email or password"})
+	}
+
+	_ = resetLoginFailures(c.Context(), h.DB, customerLoginScopes, email, nil)
+
+	h.mergeGuestCart(c, customer.ID)
+
+	return h.respondWithToken(c, 200, customer)
+}
+
+func (h *CustomerHandler) respondWithToken(c *fiber.Ctx, status int, customer models.Customer) error {
+	token, expiresAt, err := middleware.GenerateCustomerToken(customer)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to issue token"})
+	}
+
+	return c.Status(status).JSON(AuthResponse{
+		Token:     token,
+		ExpiresAt: expiresAt,
+		User:      customer,
+	})
+}
+
+// mergeGuestCart folds the anonymous cart sent in X-Cart-Token into the
+// customer's cart. A failed merge does not fail the login.
+func (h *CustomerHandler) mergeGuestCart(c *fiber.Ctx, customerID uuid.UUID) {
+	cartToken := c.Get(CartTokenHeader)
+	if cartToken == "" {
+		return
+	}
+
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		log.Println("customer: failed to merge cart:", err)
+		return
+	}
+	defer tx.Rollback(c.Context())
+
+	if err := mergeGuestCart(c.Context(), tx, cartToken, customerID); err != nil {
+		log.Println("customer: failed to merge cart:", err)
+		return
+	}
+	if err := tx.Commit(c.Context()); err != nil {
+		log.Println("customer: failed to merge cart:", err)
+	}
+}
+
+func currentCustomerID(c *fiber.Ctx) (uuid.UUID, error) {
+	claims := middleware.CustomerFromContext(c)
+	if claims == nil {
+		return uuid.Nil, errors.New("no authenticated customer")
+	}
+	return uuid.Parse(claims.CustomerID)
+}
+
+func (h *CustomerHandler) GetMe(c *fiber.Ctx) error {
+	customerUUID, err := currentCustomerID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	var customer models.Customer
+	err = scanCustomer(h.DB.QueryRow(
+		c.Context(),
+		`SELECT `+customerColumns+` FROM customers WHERE id = $1`,
+		customerUUID,
+	), &customer)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "account not found"})
+	}
+
+	return c.JSON(customer)
+}
+
+type UpdateProfileRequest struct {
+	Name string `json:"name"`
+}
+
+func (h *CustomerHandler) UpdateMe(c *fiber.Ctx) error {
+	customerUUID, err := currentCustomerID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	var req UpdateProfileRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+
+	var customer models.Customer
+	err = scanCustomer(h.DB.QueryRow(
+		c.Context(),
+		`UPDATE customers SET name = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2 RETURNING `+customerColumns,
+		strings.TrimSpace(req.Name), customerUUID,
+	), &customer)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "account not found"})
+	}
+
+	return c.JSON(customer)
+}
+
+func (h *CustomerHandler) GetMyOrders(c *fiber.Ctx) error {
+	customerUUID, err := currentCustomerID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	status := c.Query("status", "")
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	offset := (page - 1) * limit
+
+	orders, total, err := listOrders(
+		c.Context(), h.DB,
+		orderFilter{Status: status, CustomerID: &customerUUID},
+		limit, offset,
+	)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch orders"})
+	}
+
+	return c.JSON(OrdersResponse{
+		Orders: orders,
+		Total:  total,
+		Page:   page,
+		Limit:  limit,
+	})
+}
+
+func (h *CustomerHandler) GetMyOrder(c *fiber.Ctx) error {
+	customerUUID, err := currentCustomerID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	orderUUID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid order id"})
+	}
+
+	// Orders of other customers are reported as missing, not forbidden, so
+	// order ids cannot be probed.
+	order, err := loadOrder(c.Context(), h.DB, orderUUID, &customerUUID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "order not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch order"})
+	}
+
+	return c.JSON(order)
+}
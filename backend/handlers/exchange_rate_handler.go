@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/Biz0n58/Zaria/backend/currency"
+	"github.com/Biz0n58/Zaria/backend/middleware"
+	"github.com/Biz0n58/Zaria/backend/models"
+	"github.com/Biz0n58/Zaria/backend/pricing"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type ExchangeRateHandler struct {
+	DB *pgxpool.Pool
+}
+
+func NewExchangeRateHandler(db *pgxpool.Pool) *ExchangeRateHandler {
+	return &ExchangeRateHandler{DB: db}
+}
+
+const exchangeRateColumns = `currency, rate::float8, created_at, updated_at`
+
+func scanExchangeRate(row pgx.Row, r *models.ExchangeRate) error {
+	return row.Scan(&r.Currency, &r.Rate, &r.CreatedAt, &r.UpdatedAt)
+}
+
+type ExchangeRateRequest struct {
+	Rate float64 `json:"rate"`
+}
+
+type ExchangeRatesResponse struct {
+	BaseCurrency  string                `json:"base_currency"`
+	ExchangeRates []models.ExchangeRate `json:"exchange_rates"`
+}
+
+func (h *ExchangeRateHandler) ListExchangeRates(c *fiber.Ctx) error {
+	rows, err := h.DB.Query(c.Context(), `SELECT `+exchangeRateColumns+` FROM exchange_rates ORDER BY currency`)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch exchange rates"})
+	}
+	defer rows.Close()
+
+	rates := []models.ExchangeRate{}
+	for rows.Next() {
+		var r models.ExchangeRate
+		if err := scanExchangeRate(rows, &r); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to scan exchange rate"})
+		}
+		rates = append(rates, r)
+	}
+
+	return c.JSON(ExchangeRatesResponse{BaseCurrency: pricing.DefaultCurrency, ExchangeRates: rates})
+}
+
+// PutExchangeRate creates or replaces the rate of the currency in the path.
+func (h *ExchangeRateHandler) PutExchangeRate(c *fiber.Ctx) error {
+	code := currency.Normalize(c.Params("currency"))
+	if !currency.Valid(code) {
+		return c.Status(400).JSON(fiber.Map{"error": "currency must be a three-letter ISO code"})
+	}
+	if code == pricing.DefaultCurrency {
+		return c.Status(400).JSON(fiber.Map{"error": "the base currency has no exchange rate"})
+	}
+
+	var req ExchangeRateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+	if req.Rate <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "rate must be positive"})
+	}
+
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+	}
+	defer tx.Rollback(c.Context())
+
+	var before *models.ExchangeRate
+	var existing models.ExchangeRate
+	err = scanExchangeRate(tx.QueryRow(
+		c.Context(),
+		`SELECT `+exchangeRateColumns+` FROM exchange_rates WHERE currency = $1 FOR UPDATE`,
+		code,
+	), &existing)
+	if err == nil {
+		before = &existing
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch exchange rate"})
+	}
+
+	var rate models.ExchangeRate
+	err = scanExchangeRate(tx.QueryRow(
+		c.Context(),
+		`INSERT INTO exchange_rates (currency, rate) VALUES ($1, $2)
+		 ON CONFLICT (currency) DO UPDATE SET rate = EXCLUDED.rate, updated_at = CURRENT_TIMESTAMP
+		 RETURNING `+exchangeRateColumns,
+		code, req.Rate,
+	), &rate)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to save exchange rate"})
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+	}
+
+	middleware.SetAudit(c, "", "exchange_rate", code, before, rate)
+
+	return c.JSON(rate)
+}
+
+// DeleteExchangeRate stops accepting the currency. Products priced in it
+// must be moved to another currency first.
+func (h *ExchangeRateHandler) DeleteExchangeRate(c *fiber.Ctx) error {
+	code := currency.Normalize(c.Params("currency"))
+
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+	}
+	defer tx.Rollback(c.Context())
+
+	var rate models.ExchangeRate
+	err = scanExchangeRate(tx.QueryRow(
+		c.Context(),
+		`DELETE FROM exchange_rates WHERE currency = $1 RETURNING `+exchangeRateColumns,
+		code,
+	), &rate)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "exchange rate not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "failed to delete exchange rate"})
+	}
+
+	var inUse bool
+	err = tx.QueryRow(c.Context(), `SELECT EXISTS (SELECT 1 FROM products WHERE currency = $1)`, code).Scan(&inUse)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to delete exchange rate"})
+	}
+	if inUse {
+		return c.Status(409).JSON(fiber.Map{"error": "products are priced in " + strings.ToUpper(code)})
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+	}
+
+	middleware.SetAudit(c, "", "exchange_rate", code, rate, nil)
+
+	return c.JSON(fiber.Map{"message": "exchange rate deleted"})
+}
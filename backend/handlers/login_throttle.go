@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// Login throttling state is kept in Postgres so that every backend instance
+// sees the same counters. All times are taken from the database clock.
+const (
+	// Failures per IP or email allowed before exponential backoff starts.
+	loginBackoffThreshold = 3
+	loginBackoffBase      = time.Second
+	loginBackoffMax       = 15 * time.Minute
+
+	// Counters reset once no failure has been seen for this long.
+	loginFailureWindow = time.Hour
+
+	// Consecutive failures after which the admin account itself is locked.
+	// Admin email counters are blocked just as long at the same count, so
+	// that unknown emails are answered exactly like locked accounts.
+	adminLockoutThreshold = 10
+	adminLockoutDuration  = 30 * time.Minute
+
+	throttleScopeIP    = "ip"
+	throttleScopeEmail = "email"
+
+	// Customer logins have counters of their own: anyone can register a
+	// customer account with an admin's email, and its logins must neither
+	// feed nor clear the admin counters.
+	throttleScopeCustomerIP    = "customer_ip"
+	throttleScopeCustomerEmail = "customer_email"
+)
+
+// loginScopes names the IP and email counters of one login form and whether
+// its email counter applies the admin lockout.
+type loginScopes struct {
+	ip           string
+	email        string
+	emailLockout bool
+}
+
+var (
+	adminLoginScopes    = loginScopes{ip: throttleScopeIP, email: throttleScopeEmail, emailLockout: true}
+	customerLoginScopes = loginScopes{ip: throttleScopeCustomerIP, email: throttleScopeCustomerEmail}
+)
+
+// loginRetryAfter returns how long the caller has to wait before another
+// login attempt for this IP or email is accepted; zero means not blocked.
+func loginRetryAfter(ctx context.Context, db querier, scopes loginScopes, ip, email string) (time.Duration, error) {
+	var seconds float64
+	err := db.QueryRow(
+		ctx,
+		`SELECT COALESCE(MAX(EXTRACT(EPOCH FROM (blocked_until - CURRENT_TIMESTAMP))), 0)
+		 FROM login_attempts
+		 WHERE ((scope = $1 AND key = $2) OR (scope = $3 AND key = $4))
+		   AND blocked_until > CURRENT_TIMESTAMP`,
+		scopes.ip, ip, scopes.email, email,
+	).Scan(&seconds)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// adminLockedFor returns the remaining lockout of an admin account.
+func adminLockedFor(ctx context.Context, db querier, adminID uuid.UUID) (time.Duration, error) {
+	var seconds float64
+	err := db.QueryRow(
+		ctx,
+		`SELECT COALESCE(EXTRACT(EPOCH FROM (locked_until - CURRENT_TIMESTAMP)), 0)
+		 FROM admins WHERE id = $1`,
+		adminID,
+	).Scan(&seconds)
+	if err != nil || seconds <= 0 {
+		return 0, err
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// recordLoginFailure bumps the IP and email counters and, when the email
+// belongs to an admin, the consecutive failure count on the admins row.
+func recordLoginFailure(ctx context.Context, db querier, scopes loginScopes, ip, email string, adminID *uuid.UUID) error {
+	if err := bumpLoginAttempts(ctx, db, scopes.ip, ip, false); err != nil {
+		return err
+	}
+	if err := bumpLoginAttempts(ctx, db, scopes.email, email, scopes.emailLockout); err != nil {
+		return err
+	}
+
+	if adminID == nil {
+		return nil
+	}
+
+	_, err := db.Exec(
+		ctx,
+		`UPDATE admins SET
+		   failed_login_count = failed_login_count + 1,
+		   locked_until = CASE
+		     WHEN failed_login_count + 1 >= $2 THEN CURRENT_TIMESTAMP + make_interval(secs => $3)
+		     ELSE locked_until
+		   END
+		 WHERE id = $1`,
+		*adminID, adminLockoutThreshold, adminLockoutDuration.Seconds(),
+	)
+	return err
+}
+
+func bumpLoginAttempts(ctx context.Context, db querier, scope, key string, lockout bool) error {
+	var failures int
+	err := db.QueryRow(
+		ctx,
+		`INSERT INTO login_attempts (scope, key, failures, last_failure_at)
+		 VALUES ($1, $2, 1, CURRENT_TIMESTAMP)
+		 ON CONFLICT (scope, key) DO UPDATE SET
+		   failures = CASE
+		     WHEN login_attempts.last_failure_at < CURRENT_TIMESTAMP - make_interval(secs => $3) THEN 1
+		     ELSE login_attempts.failures + 1
+		   END,
+		   last_failure_at = CURRENT_TIMESTAMP
+		 RETURNING failures`,
+		scope, key, loginFailureWindow.Seconds(),
+	).Scan(&failures)
+	if err != nil {
+		return err
+	}
+
+	if failures < loginBackoffThreshold {
+		return nil
+	}
+
+	delay := loginBackoff(failures)
+	if lockout && failures >= adminLockoutThreshold && delay < adminLockoutDuration {
+		delay = adminLockoutDuration
+	}
+
+	_, err = db.Exec(
+		ctx,
+		`UPDATE login_attempts SET blocked_until = CURRENT_TIMESTAMP + make_interval(secs => $3)
+		 WHERE scope = $1 AND key = $2`,
+		scope, key, delay.Seconds(),
+	)
+	return err
+}
+
+// loginBackoff doubles the delay for every failure past the threshold.
+func loginBackoff(failures int) time.Duration {
+	exp := failures - loginBackoffThreshold
+	if exp > 30 {
+		return loginBackoffMax
+	}
+	delay := loginBackoffBase * time.Duration(math.Pow(2, float64(exp)))
+	if delay > loginBackoffMax {
+		return loginBackoffMax
+	}
+	return delay
+}
+
+// resetLoginFailures clears the email counter and, for admins, the lockout
+// after a successful login. The IP counter is left to expire on its own so
+// that one valid account cannot be used to reset it while guessing others.
+func resetLoginFailures(ctx context.Context, db querier, scopes loginScopes, email string, adminID *uuid.UUID) error {
+	_, err := db.Exec(
+		ctx,
+		`DELETE FROM login_attempts WHERE scope = $1 AND key = $2`,
+		scopes.email, email,
+	)
+	if err != nil || adminID == nil {
+		return err
+	}
+
+	_, err = db.Exec(
+		ctx,
+		`UPDATE admins SET failed_login_count = 0, locked_until = NULL WHERE id = $1`,
+		*adminID,
+	)
+	return err
+}
+
+func tooManyAttempts(c *fiber.Ctx, retryAfter time.Duration) error {
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "too many login attempts, try again later"})
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Biz0n58/Zaria/backend/middleware"
+	"github.com/Biz0n58/Zaria/backend/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type OrderHandler struct {
+	DB *pgxpool.Pool
+}
+
+func NewOrderHandler(db *pgxpool.Pool) *OrderHandler {
+	return &OrderHandler{DB: db}
+}
+
+// PublicOrderResponse is what a guest holding an order access token can
+// see. Contact details are left out since the token travels in URLs.
+type PublicOrderResponse struct {
+	ID                 uuid.UUID               `json:"id"`
+	Status             string                  `json:"status"`
+	SubtotalCents      int                     `json:"subtotal_cents"`
+	ShippingCents      int                     `json:"shipping_cents"`
+	ShippingMethodName *string                 `json:"shipping_method_name"`
+	DiscountCents      int                     `json:"discount_cents"`
+	TaxCents           int                     `json:"tax_cents"`
+	ShippingTaxCents   int                     `json:"shipping_tax_cents"`
+	RoundingCents      int                     `json:"rounding_cents"`
+	TotalCents         int                     `json:"total_cents"`
+	Currency           string                  `json:"currency"`
+	Items              []models.OrderItem      `json:"items"`
+	Promotions         []models.OrderPromotion `json:"promotions"`
+	TaxLines           []models.OrderTaxLine   `json:"tax_lines"`
+	PaymentStatus      *string                 `json:"payment_status"`
+	CreatedAt          time.Time               `json:"created_at"`
+	UpdatedAt          time.Time               `json:"updated_at"`
+}
+
+func (h *OrderHandler) GetOrder(c *fiber.Ctx) error {
+	orderUUID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid order id"})
+	}
+
+	token := c.Query("token")
+	if token == "" {
+		return c.Status(401).JSON(fiber.Map{"error": "token required"})
+	}
+
+	tokenOrderID, err := middleware.ParseOrderAccessToken(token)
+	if err != nil || tokenOrderID != orderUUID {
+		return c.Status(401).JSON(fiber.Map{"error": "invalid or expired token"})
+	}
+
+	order, err := loadOrder(c.Context(), h.DB, orderUUID, nil)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "order not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch order"})
+	}
+
+	resp := PublicOrderResponse{
+		ID:                 order.ID,
+		Status:             order.Status,
+		SubtotalCents:      order.SubtotalCents,
+		ShippingCents:      order.ShippingCents,
+		ShippingMethodName: order.ShippingMethodName,
+		DiscountCents:      order.DiscountCents,
+		TaxCents:           order.TaxCents,
+		ShippingTaxCents:   order.ShippingTaxCents,
+		RoundingCents:      order.RoundingCents,
+		TotalCents:         order.TotalCents,
+		Currency:           order.Currency,
+		Items:              order.Items,
+		Promotions:         order.Promotions,
+		TaxLines:           order.TaxLines,
+		CreatedAt:          order.CreatedAt,
+		UpdatedAt:          order.UpdatedAt,
+	}
+	if resp.Items == nil {
+		resp.Items = []models.OrderItem{}
+	}
+	if resp.Promotions == nil {
+		resp.Promotions = []models.OrderPromotion{}
+	}
+	if resp.TaxLines == nil {
+		resp.TaxLines = []models.OrderTaxLine{}
+	}
+	if order.Payment != nil {
+		resp.PaymentStatus = &order.Payment.Status
+	}
+
+	return c.JSON(resp)
+}
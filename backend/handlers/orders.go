@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/Biz0n58/Zaria/backend/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const orderColumns = `id, customer_id, customer_email, status, subtotal_cents, shipping_cents, shipping_method, shipping_method_name, discount_cents, tax_cents, shipping_tax_cents, rounding_cents, total_cents, currency, created_at, updated_at`
+
+func scanOrder(row pgx.Row, o *models.Order) error {
+	return row.Scan(
+		&o.ID, &o.CustomerID, &o.CustomerEmail, &o.Status, &o.SubtotalCents,
+		&o.ShippingCents, &o.ShippingMethod, &o.ShippingMethodName, &o.DiscountCents, &o.TaxCents, &o.ShippingTaxCents, &o.RoundingCents, &o.TotalCents, &o.Currency, &o.CreatedAt, &o.UpdatedAt,
+	)
+}
+
+type orderFilter struct {
+	Status     string
+	CustomerID *uuid.UUID
+}
+
+// listOrders returns one page of orders, newest first, plus the total number
+// of orders matching the filter.
+func listOrders(ctx context.Context, db querier, filter orderFilter, limit, offset int) ([]models.Order, int, error) {
+	where := ` WHERE 1=1`
+	args := []interface{}{}
+
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		where += ` AND status = $` + strconv.Itoa(len(args))
+	}
+	if filter.CustomerID != nil {
+		args = append(args, *filter.CustomerID)
+		where += ` AND customer_id = $` + strconv.Itoa(len(args))
+	}
+
+	var total int
+	if err := db.QueryRow(ctx, `SELECT COUNT(*) FROM orders`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT ` + orderColumns + ` FROM orders` + where +
+		` ORDER BY created_at DESC LIMIT $` + strconv.Itoa(len(args)+1) + ` OFFSET $` + strconv.Itoa(len(args)+2)
+
+	rows, err := db.Query(ctx, query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	orders := []models.Order{}
+	for rows.Next() {
+		var o models.Order
+		if err := scanOrder(rows, &o); err != nil {
+			return nil, 0, err
+		}
+		orders = append(orders, o)
+	}
+
+	return orders, total, rows.Err()
+}
+
+// loadOrder fetches an order with its items, latest payment, addresses,
+// applied promotions and tax lines. When customerID is set the order must
+// also belong to that customer, otherwise pgx.ErrNoRows is returned as if it
+// did not exist.
+func loadOrder(ctx context.Context, db querier, orderID uuid.UUID, customerID *uuid.UUID) (models.Order, error) {
+	var order models.Order
+
+	query := `SELECT ` + orderColumns + ` FROM orders WHERE id = $1`
+	args := []interface{}{orderID}
+	if customerID != nil {
+		query += ` AND customer_id = $2`
+		args = append(args, *customerID)
+	}
+
+	if err := scanOrder(db.QueryRow(ctx, query, args...), &order); err != nil {
+		return order, err
+	}
+
+	rows, err := db.Query(
+		ctx,
+		`SELECT id, order_id, product_id, variant_id, sku, variant_options, name_snapshot, price_cents_snapshot, qty, tax_class, tax_cents 
+		 FROM order_items WHERE order_id = $1`,
+		orderID,
+	)
+	if err != nil {
+		return order, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.OrderItem
+		err := rows.Scan(
+			&item.ID, &item.OrderID, &item.ProductID, &item.VariantID, &item.SKU, &item.VariantOptions, &item.NameSnapshot,
+			&item.PriceCentsSnapshot, &item.Qty, &item.TaxClass, &item.TaxCents,
+		)
+		if err != nil {
+			return order, err
+		}
+		order.Items = append(order.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return order, err
+	}
+
+	var payment models.Payment
+	err = db.QueryRow(
+		ctx,
+		`SELECT id, order_id, provider, provider_ref, status, amount_cents, currency, created_at, updated_at 
+		 FROM payments WHERE order_id = $1 ORDER BY created_at DESC LIMIT 1`,
+		orderID,
+	).Scan(
+		&payment.ID, &payment.OrderID, &payment.Provider, &payment.ProviderRef,
+		&payment.Status, &payment.AmountCents, &payment.Currency, &payment.CreatedAt, &payment.UpdatedAt,
+	)
+	if err == nil {
+		order.Payment = &payment
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return order, err
+	}
+
+	if err := loadOrderAddresses(ctx, db, &order); err != nil {
+		return order, err
+	}
+	if err := loadOrderPromotions(ctx, db, &order); err != nil {
+		return order, err
+	}
+	if err := loadOrderTaxLines(ctx, db, &order); err != nil {
+		return order, err
+	}
+
+	return order, nil
+}
@@ -2,11 +2,18 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"os"
+	"strconv"
 
+	"github.com/Biz0n58/Zaria/backend/currency"
+	"github.com/Biz0n58/Zaria/backend/inventory"
+	"github.com/Biz0n58/Zaria/backend/middleware"
 	"github.com/Biz0n58/Zaria/backend/models"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/stripe/stripe-go/v78"
 	"github.com/stripe/stripe-go/v78/paymentintent"
@@ -49,9 +56,9 @@ func (h *PaymentHandler) CreateStripeIntent(c *fiber.Ctx) error {
 	var order models.Order
 	err = h.DB.QueryRow(
 		c.Context(),
-		`SELECT id, total_cents, currency, status FROM orders WHERE id = $1`,
+		`SELECT id, total_cents, tax_cents, currency, status FROM orders WHERE id = $1`,
 		orderUUID,
-	).Scan(&order.ID, &order.TotalCents, &order.Currency, &order.Status)
+	).Scan(&order.ID, &order.TotalCents, &order.TaxCents, &order.Currency, &order.Status)
 	if err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "order not found"})
 	}
@@ -60,27 +67,39 @@ func (h *PaymentHandler) CreateStripeIntent(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "order not in pending status"})
 	}
 
+	// total_cents already includes the tax computed at checkout; tax_cents
+	// is passed along for reference in the Stripe dashboard. Amounts are in
+	// the currency's minor unit, which Stripe expects except for a few
+	// currencies that StripeAmount adjusts.
 	params := &stripe.PaymentIntentParams{
-		Amount:   stripe.Int64(int64(order.TotalCents)),
+		Amount:   stripe.Int64(currency.StripeAmount(order.TotalCents, order.Currency)),
 		Currency: stripe.String(order.Currency),
 		Metadata: map[string]string{
-			"order_id": order.ID.String(),
+			"order_id":  order.ID.String(),
+			"tax_cents": strconv.Itoa(order.TaxCents),
 		},
 	}
 
+	// Forward the client's key so that a retry after a lost response gets
+	// the same PaymentIntent back from Stripe.
+	if key := middleware.IdempotencyKeyFromContext(c); key != "" {
+		params.SetIdempotencyKey("create-intent:" + order.ID.String() + ":" + key)
+	}
+
 	pi, err := paymentintent.New(params)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "failed to create payment intent"})
 	}
 
-	var paymentID uuid.UUID
-	err = h.DB.QueryRow(
+	// Stripe returns the same PaymentIntent for a repeated idempotency key,
+	// in which case the payment row already exists.
+	_, err = h.DB.Exec(
 		c.Context(),
 		`INSERT INTO payments (order_id, provider, provider_ref, status, amount_cents, currency) 
-		 VALUES ($1, $2, $3, $4, $5, $6) 
-		 RETURNING id`,
+		 SELECT $1, $2, $3, $4, $5, $6
+		 WHERE NOT EXISTS (SELECT 1 FROM payments WHERE provider = $2 AND provider_ref = $3)`,
 		order.ID, "stripe", pi.ID, "pending", order.TotalCents, order.Currency,
-	).Scan(&paymentID)
+	)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "failed to save payment"})
 	}
@@ -118,7 +137,13 @@ func (h *PaymentHandler) StripeWebhook(c *fiber.Ctx) error {
 			return c.Status(400).JSON(fiber.Map{"error": "invalid order_id"})
 		}
 
-		_, err = h.DB.Exec(
+		tx, err := h.DB.Begin(c.Context())
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+		}
+		defer tx.Rollback(c.Context())
+
+		_, err = tx.Exec(
 			c.Context(),
 			`UPDATE payments SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE provider_ref = $2`,
 			"succeeded", pi.ID,
@@ -127,16 +152,64 @@ func (h *PaymentHandler) StripeWebhook(c *fiber.Ctx) error {
 			return c.Status(500).JSON(fiber.Map{"error": "failed to update payment"})
 		}
 
-		_, err = h.DB.Exec(
-			c.Context(),
-			`UPDATE orders SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`,
-			"paid", orderUUID,
-		)
+		var orderStatus string
+		err = tx.QueryRow(c.Context(), `SELECT status FROM orders WHERE id = $1 FOR UPDATE`, orderUUID).Scan(&orderStatus)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "order not found"})
+		}
 		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "failed to update order"})
+			return c.Status(500).JSON(fiber.Map{"error": "failed to fetch order"})
+		}
+
+		newStatus := ""
+		switch orderStatus {
+		case "pending":
+			// Paid orders keep their stock for good.
+			if err := inventory.Commit(c.Context(), tx, orderUUID); err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "failed to update stock"})
+			}
+			newStatus = "paid"
+		case "paid", "shipped", "refund_required":
+			// Already handled.
+		default:
+			// The order was cancelled or failed and its stock released
+			// before the payment went through. It is only paid if that
+			// stock can be taken back; otherwise the money has to be
+			// returned.
+			ok, err := inventory.Reclaim(c.Context(), tx, orderUUID)
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "failed to update stock"})
+			}
+			newStatus = "refund_required"
+			if ok {
+				if err := inventory.Commit(c.Context(), tx, orderUUID); err != nil {
+					return c.Status(500).JSON(fiber.Map{"error": "failed to update stock"})
+				}
+				newStatus = "paid"
+			} else {
+				log.Printf("payments: order %s was paid after its stock was sold, refund required", orderUUID)
+			}
+		}
+
+		if newStatus != "" {
+			_, err = tx.Exec(
+				c.Context(),
+				`UPDATE orders SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`,
+				newStatus, orderUUID,
+			)
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "failed to update order"})
+			}
+		}
+
+		if err := tx.Commit(c.Context()); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
 		}
 
-	case "payment_intent.payment_failed":
+	case "payment_intent.payment_failed", "payment_intent.canceled":
+		// The order fails and its stock goes back. Should a retry on the
+		// same intent succeed later, the succeeded event takes the stock
+		// back if it is still there.
 		var pi stripe.PaymentIntent
 		if err := json.Unmarshal(event.Data.Raw, &pi); err != nil {
 			return c.Status(400).JSON(fiber.Map{"error": "invalid payload"})
@@ -152,22 +225,55 @@ func (h *PaymentHandler) StripeWebhook(c *fiber.Ctx) error {
 			return c.Status(400).JSON(fiber.Map{"error": "invalid order_id"})
 		}
 
-		_, err = h.DB.Exec(
+		status := "failed"
+		if event.Type == "payment_intent.canceled" {
+			status = "canceled"
+		}
+
+		tx, err := h.DB.Begin(c.Context())
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+		}
+		defer tx.Rollback(c.Context())
+
+		_, err = tx.Exec(
 			c.Context(),
-			`UPDATE payments SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE provider_ref = $2`,
-			"failed", pi.ID,
+			`UPDATE payments SET status = $1, updated_at = CURRENT_TIMESTAMP
+			 WHERE provider_ref = $2 AND status <> 'succeeded'`,
+			status, pi.ID,
 		)
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{"error": "failed to update payment"})
 		}
 
-		_, err = h.DB.Exec(
-			c.Context(),
-			`UPDATE orders SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`,
-			"failed", orderUUID,
-		)
+		// Only an unpaid order fails; a late event for an order that has
+		// been paid or cancelled in the meantime changes nothing.
+		var orderStatus string
+		err = tx.QueryRow(c.Context(), `SELECT status FROM orders WHERE id = $1 FOR UPDATE`, orderUUID).Scan(&orderStatus)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "order not found"})
+		}
 		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "failed to update order"})
+			return c.Status(500).JSON(fiber.Map{"error": "failed to fetch order"})
+		}
+
+		if orderStatus == "pending" {
+			// The stock held by the order goes back on sale.
+			if err := inventory.Release(c.Context(), tx, orderUUID); err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "failed to update stock"})
+			}
+			_, err = tx.Exec(
+				c.Context(),
+				`UPDATE orders SET status = 'failed', updated_at = CURRENT_TIMESTAMP WHERE id = $1`,
+				orderUUID,
+			)
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "failed to update order"})
+			}
+		}
+
+		if err := tx.Commit(c.Context()); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
 		}
 	}
 
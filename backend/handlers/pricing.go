@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/Biz0n58/Zaria/backend/currency"
+	"github.com/Biz0n58/Zaria/backend/pricing"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// checkoutItems returns the items to price for req: either req.Items or the
+// contents of req.CartID, which the caller must be allowed to use. With lock
+// set the cart row is locked so it cannot be checked out twice; cartID is
+// uuid.Nil when no cart was given. A cart's currency is used when
+// req.Currency is empty.
+func checkoutItems(c *fiber.Ctx, db querier, req *CheckoutRequest, customerID *uuid.UUID, lock bool) ([]CheckoutItem, uuid.UUID, *fiber.Error) {
+	if req.CartID != "" && len(req.Items) > 0 {
+		return nil, uuid.Nil, fiber.NewError(400, "send either items or cart_id")
+	}
+	if req.CartID == "" {
+		if len(req.Items) == 0 {
+			return nil, uuid.Nil, fiber.NewError(400, "items required")
+		}
+		return req.Items, uuid.Nil, nil
+	}
+
+	cartID, err := uuid.Parse(req.CartID)
+	if err != nil {
+		return nil, uuid.Nil, fiber.NewError(400, "invalid cart id")
+	}
+
+	err = authorizeCart(c.Context(), db, cartID, customerID, c.Get(CartTokenHeader), lock)
+	if errors.Is(err, errCartNotFound) {
+		return nil, uuid.Nil, fiber.NewError(404, "cart not found")
+	}
+	if err != nil {
+		return nil, uuid.Nil, fiber.NewError(500, "failed to fetch cart")
+	}
+
+	items, cartCurrency, err := cartCheckoutItems(c.Context(), db, cartID)
+	if err != nil {
+		return nil, uuid.Nil, fiber.NewError(500, "failed to fetch cart")
+	}
+	if req.Currency == "" {
+		req.Currency = cartCurrency
+	}
+	if len(items) == 0 {
+		return nil, uuid.Nil, fiber.NewError(400, "cart is empty")
+	}
+
+	return items, cartID, nil
+}
+
+// pricingError turns an error from pricing.Calculate into a response.
+func pricingError(err error) *fiber.Error {
+	var perr *pricing.PromotionError
+	if errors.As(err, &perr) {
+		return fiber.NewError(400, perr.Reason)
+	}
+	return fiber.NewError(500, "failed to price order")
+}
+
+// lineKey identifies a line: a product, or one of its variants.
+type lineKey struct {
+	product uuid.UUID
+	variant uuid.UUID
+}
+
+// pricingLines loads the current price of every product or variant in
+// items, in the currency cur, and checks that it can be bought in the
+// requested quantity. Repeated items are combined into one line. Without cur
+// all products must share their currency, which is returned. With lock set
+// the product and variant rows are locked, in a fixed order to avoid
+// deadlocks between concurrent checkouts.
+func pricingLines(ctx context.Context, db querier, items []CheckoutItem, rates currency.Rates, cur string, lock bool) ([]pricing.Line, string, *fiber.Error) {
+	qty := map[lineKey]int{}
+	for _, item := range items {
+		productUUID, err := uuid.Parse(item.ProductID)
+		if err != nil {
+			return nil, "", fiber.NewError(400, "invalid product id")
+		}
+		variantID, ferr := parseVariantID(item.VariantID)
+		if ferr != nil {
+			return nil, "", ferr
+		}
+		if item.Qty < 1 {
+			return nil, "", fiber.NewError(400, "qty must be at least 1")
+		}
+		key := lineKey{product: productUUID}
+		if variantID != nil {
+			key.variant = *variantID
+		}
+		qty[key] += item.Qty
+	}
+
+	keys := make([]lineKey, 0, len(qty))
+	for key := range qty {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].product != keys[j].product {
+			return keys[i].product.String() < keys[j].product.String()
+		}
+		return keys[i].variant.String() < keys[j].variant.String()
+	})
+
+	query := `SELECT name, price_cents, currency,
+		  (SELECT price_cents FROM product_prices WHERE product_id = products.id AND currency = $2),
+		  stock, weight_grams, length_mm::bigint * width_mm * height_mm, tax_class,
+		  ARRAY(SELECT category_id::text FROM product_categories WHERE product_id = products.id),
+		  EXISTS (SELECT 1 FROM product_variants WHERE product_id = products.id)
+		FROM products WHERE id = $1 AND is_active = true`
+	variantQuery := `SELECT v.sku, v.price_cents, v.stock, ` + variantOptionsSQL + `
+		FROM product_variants v WHERE v.id = $1 AND v.product_id = $2 AND v.is_active = true`
+	if lock {
+		query += ` FOR UPDATE`
+		variantQuery += ` FOR UPDATE`
+	}
+
+	lines := make([]pricing.Line, 0, len(keys))
+	shared := ""
+	for _, key := range keys {
+		line := pricing.Line{ProductID: key.product, Qty: qty[key]}
+		var priceCents, stock int
+		var productCurrency string
+		var explicitPrice *int
+		var categoryIDs []string
+		var hasVariants bool
+		err := db.QueryRow(ctx, query, key.product, cur).Scan(
+			&line.Name, &priceCents, &productCurrency, &explicitPrice,
+			&stock, &line.WeightGrams, &line.VolumeMM3, &line.TaxClass, &categoryIDs, &hasVariants,
+		)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, "", fiber.NewError(404, "product not found")
+		}
+		if err != nil {
+			return nil, "", fiber.NewError(500, "failed to fetch product")
+		}
+
+		if key.variant != uuid.Nil {
+			// A variant has its own stock; a price override replaces the
+			// product's price and its explicit prices.
+			var variantPrice *int
+			err := db.QueryRow(ctx, variantQuery, key.variant, key.product).Scan(
+				&line.SKU, &variantPrice, &stock, &line.VariantOptions,
+			)
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil, "", fiber.NewError(404, "variant not found")
+			}
+			if err != nil {
+				return nil, "", fiber.NewError(500, "failed to fetch variant")
+			}
+			variantID := key.variant
+			line.VariantID = &variantID
+			if variantPrice != nil {
+				priceCents = *variantPrice
+				explicitPrice = nil
+			}
+		} else if hasVariants {
+			return nil, "", fiber.NewError(400, "variant_id is required for "+line.Name)
+		}
+
+		if stock < line.Qty {
+			return nil, "", fiber.NewError(400, "insufficient stock")
+		}
+		if line.CategoryIDs, err = parseUUIDs(categoryIDs); err != nil {
+			return nil, "", fiber.NewError(500, "failed to fetch product")
+		}
+
+		if cur == "" {
+			if shared == "" {
+				shared = productCurrency
+			} else if productCurrency != shared {
+				return nil, "", fiber.NewError(400, "items are priced in different currencies; send a currency to check out in")
+			}
+			line.UnitPriceCents = priceCents
+		} else {
+			var ok bool
+			line.UnitPriceCents, ok = localPrice(rates, priceCents, productCurrency, explicitPrice, cur)
+			if !ok {
+				return nil, "", fiber.NewError(400, line.Name+" is not available in "+strings.ToUpper(cur))
+			}
+		}
+		lines = append(lines, line)
+	}
+
+	if cur == "" {
+		cur = shared
+	}
+	return lines, cur, nil
+}
@@ -1,12 +1,19 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"regexp"
 	"strconv"
 	"strings"
 
+	"github.com/Biz0n58/Zaria/backend/middleware"
 	"github.com/Biz0n58/Zaria/backend/models"
+	"github.com/Biz0n58/Zaria/backend/tax"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -18,14 +25,64 @@ func NewProductHandler(db *pgxpool.Pool) *ProductHandler {
 	return &ProductHandler{DB: db}
 }
 
+const productColumns = `id, name, description, price_cents, currency, image_url, stock,
+	weight_grams, length_mm, width_mm, height_mm, tax_class,
+	COALESCE((SELECT json_agg(json_build_object('currency', pp.currency, 'price_cents', pp.price_cents) ORDER BY pp.currency)
+	          FROM product_prices pp WHERE pp.product_id = products.id), '[]'),
+	ARRAY(SELECT category_id::text FROM product_categories WHERE product_id = products.id ORDER BY category_id),
+	is_active, created_at, updated_at`
+
+func scanProduct(row pgx.Row, p *models.Product) error {
+	return scanProductWith(row, p)
+}
+
+// scanProductWith scans productColumns followed by extra columns.
+func scanProductWith(row pgx.Row, p *models.Product, extra ...any) error {
+	var categoryIDs []string
+	dest := []any{
+		&p.ID, &p.Name, &p.Description, &p.PriceCents, &p.Currency,
+		&p.ImageURL, &p.Stock, &p.WeightGrams, &p.LengthMM, &p.WidthMM, &p.HeightMM, &p.TaxClass, &p.Prices,
+		&categoryIDs, &p.IsActive, &p.CreatedAt, &p.UpdatedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+	var err error
+	p.CategoryIDs, err = parseUUIDs(categoryIDs)
+	return err
+}
+
+var taxClassPattern = regexp.MustCompile(`^[a-z0-9_-]{1,50}$`)
+
 type ProductsResponse struct {
 	Products []models.Product `json:"products"`
 	Total    int              `json:"total"`
 	Page     int              `json:"page"`
 	Limit    int              `json:"limit"`
+	Facets   ProductFacets    `json:"facets"`
 }
 
+// GetProducts lists products matching the filters of the query, with facet
+// counts for narrowing them further. Price filters, price sorting and the
+// price facet compare the prices shown, so they need ?currency=; without it
+// products keep their own currencies.
 func (h *ProductHandler) GetProducts(c *fiber.Ctx) error {
+	target, rates, ferr := catalogCurrency(c, h.DB)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
+	if target == "" {
+		// Collection price rules still need the rates.
+		var err error
+		rates, err = exchangeRates(c.Context(), h.DB)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to fetch exchange rates"})
+		}
+	}
+	price := func(args *sqlArgs) string {
+		return listingPriceSQL(args, rates, target)
+	}
+
 	search := c.Query("search", "")
 	page, _ := strconv.Atoi(c.Query("page", "1"))
 	limit, _ := strconv.Atoi(c.Query("limit", "50"))
@@ -39,29 +96,106 @@ func (h *ProductHandler) GetProducts(c *fiber.Ctx) error {
 	}
 	offset := (page - 1) * limit
 
-	query := `SELECT id, name, description, price_cents, currency, image_url, stock, is_active, created_at, updated_at FROM products WHERE 1=1`
-	args := []interface{}{}
-	argPos := 1
+	var where sqlWhere
 
+	search = strings.TrimSpace(search)
 	if search != "" {
-		query += ` AND (name ILIKE $` + strconv.Itoa(argPos) + ` OR description ILIKE $` + strconv.Itoa(argPos) + `)`
-		args = append(args, "%"+search+"%")
-		argPos++
+		where.add(func(args *sqlArgs) string {
+			return searchMatchSQL(args.add(search))
+		})
 	}
 
 	if isActiveStr != "" {
 		isActive, err := strconv.ParseBool(isActiveStr)
 		if err == nil {
-			query += ` AND is_active = $` + strconv.Itoa(argPos)
-			args = append(args, isActive)
-			argPos++
+			where.add(func(args *sqlArgs) string {
+				return `is_active = ` + args.add(isActive)
+			})
+		}
+	}
+
+	// category includes the products of every subcategory.
+	if category := c.Query("category"); category != "" {
+		where.addFacet(facetCategory, func(args *sqlArgs) string {
+			return productInCategorySQL(args.add(category))
+		})
+	}
+
+	if slug := c.Query("collection"); slug != "" {
+		col, err := loadCollectionBySlug(c.Context(), h.DB, slug)
+		if errors.Is(err, pgx.ErrNoRows) || (err == nil && !col.IsActive) {
+			return c.Status(404).JSON(fiber.Map{"error": "collection not found"})
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to fetch collection"})
 		}
+		where.add(collectionCondition(col, rates))
 	}
 
-	query += ` ORDER BY updated_at DESC LIMIT $` + strconv.Itoa(argPos) + ` OFFSET $` + strconv.Itoa(argPos+1)
-	args = append(args, limit, offset)
+	minPrice, ferr := priceBound(c, "min_price_cents")
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
+	maxPrice, ferr := priceBound(c, "max_price_cents")
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
+	if target == "" && (minPrice != nil || maxPrice != nil) {
+		return c.Status(400).JSON(fiber.Map{"error": "min_price_cents and max_price_cents need currency"})
+	}
+	if minPrice != nil && maxPrice != nil && *minPrice > *maxPrice {
+		return c.Status(400).JSON(fiber.Map{"error": "min_price_cents must not exceed max_price_cents"})
+	}
+	if minPrice != nil {
+		where.addFacet(facetPrice, func(args *sqlArgs) string {
+			return `(` + price(args) + `) >= ` + args.add(*minPrice)
+		})
+	}
+	if maxPrice != nil {
+		where.addFacet(facetPrice, func(args *sqlArgs) string {
+			return `(` + price(args) + `) <= ` + args.add(*maxPrice)
+		})
+	}
 
-	rows, err := h.DB.Query(c.Context(), query, args...)
+	if inStockStr := c.Query("in_stock"); inStockStr != "" {
+		inStock, err := strconv.ParseBool(inStockStr)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "in_stock must be true or false"})
+		}
+		if inStock {
+			where.addFacet(facetInStock, func(args *sqlArgs) string {
+				return `(` + productStockSQL + `) > 0`
+			})
+		}
+	}
+
+	options, ferr := parseOptionFilters(c)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
+	if len(options) > 0 {
+		where.addFacet(facetOption, optionsCondition(options))
+	}
+
+	// Searches come with highlighted snippets.
+	var args sqlArgs
+	columns := productColumns
+	if search != "" {
+		columns += `, ` + searchHighlightSQL(args.add(search))
+	}
+	whereSQL := where.build(&args, nil)
+	sortBy := c.Query("sort")
+	if target == "" && (sortBy == "price_asc" || sortBy == "price_desc") {
+		return c.Status(400).JSON(fiber.Map{"error": "sorting by price needs currency"})
+	}
+	order, ok := productOrderSQL(&args, sortBy, search, price)
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "sort must be relevance, newest, price_asc, price_desc, name_asc, name_desc or popularity"})
+	}
+	query := `SELECT ` + columns + ` FROM products` + whereSQL + order +
+		` LIMIT ` + args.add(limit) + ` OFFSET ` + args.add(offset)
+
+	rows, err := h.DB.Query(c.Context(), query, args.values...)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch products"})
 	}
@@ -70,49 +204,103 @@ func (h *ProductHandler) GetProducts(c *fiber.Ctx) error {
 	products := []models.Product{}
 	for rows.Next() {
 		var p models.Product
-		err := rows.Scan(
-			&p.ID, &p.Name, &p.Description, &p.PriceCents, &p.Currency,
-			&p.ImageURL, &p.Stock, &p.IsActive, &p.CreatedAt, &p.UpdatedAt,
-		)
+		var err error
+		if search != "" {
+			p.Highlight = &models.ProductHighlight{}
+			err = scanProductWith(rows, &p, &p.Highlight.Name, &p.Highlight.Description)
+		} else {
+			err = scanProduct(rows, &p)
+		}
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{"error": "failed to scan product"})
 		}
+		if target != "" {
+			localizeProduct(&p, rates, target)
+		}
 		products = append(products, p)
 	}
-
-	countQuery := `SELECT COUNT(*) FROM products WHERE 1=1`
-	countArgs := []interface{}{}
-	countArgPos := 1
-
-	if search != "" {
-		countQuery += ` AND (name ILIKE $` + strconv.Itoa(countArgPos) + ` OR description ILIKE $` + strconv.Itoa(countArgPos) + `)`
-		countArgs = append(countArgs, "%"+search+"%")
-		countArgPos++
-	}
-
-	if isActiveStr != "" {
-		isActive, err := strconv.ParseBool(isActiveStr)
-		if err == nil {
-			countQuery += ` AND is_active = $` + strconv.Itoa(countArgPos)
-			countArgs = append(countArgs, isActive)
-			countArgPos++
-		}
+	if err := rows.Err(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch products"})
 	}
 
 	var total int
-	err = h.DB.QueryRow(c.Context(), countQuery, countArgs...).Scan(&total)
+	var countArgs sqlArgs
+	err = h.DB.QueryRow(c.Context(), `SELECT COUNT(*) FROM products`+where.build(&countArgs, nil), countArgs.values...).Scan(&total)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "failed to count products"})
 	}
 
+	facets, err := productFacets(c.Context(), h.DB, &where, price, options, target)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to count facets"})
+	}
+
 	return c.JSON(ProductsResponse{
 		Products: products,
 		Total:    total,
 		Page:     page,
 		Limit:    limit,
+		Facets:   facets,
 	})
 }
 
+type ProductSuggestion struct {
+	ID       uuid.UUID `json:"id"`
+	Name     string    `json:"name"`
+	ImageURL *string   `json:"image_url"`
+	// Highlight is the HTML-escaped name with the matched prefixes wrapped
+	// in <mark>.
+	Highlight string `json:"highlight"`
+}
+
+type ProductSuggestionsResponse struct {
+	Suggestions []ProductSuggestion `json:"suggestions"`
+}
+
+// SuggestProducts autocompletes q against the names and descriptions of
+// active products, treating every word as a prefix and tolerating typos.
+// Names starting with q come first.
+func (h *ProductHandler) SuggestProducts(c *fiber.Ctx) error {
+	q := strings.TrimSpace(c.Query("q"))
+	limit, _ := strconv.Atoi(c.Query("limit", "8"))
+	if limit < 1 || limit > 20 {
+		limit = 8
+	}
+
+	suggestions := []ProductSuggestion{}
+	prefix := prefixTSQuery(q)
+	if len([]rune(q)) < 2 || prefix == "" {
+		return c.JSON(ProductSuggestionsResponse{Suggestions: suggestions})
+	}
+
+	rows, err := h.DB.Query(
+		c.Context(),
+		`SELECT id, name, image_url,
+		   ts_headline('english', `+htmlEscapeSQL(`name`)+`, to_tsquery('english', $1), 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true')
+		 FROM products
+		 WHERE is_active = true AND (search_vector @@ to_tsquery('english', $1) OR $2 <% name)
+		 ORDER BY starts_with(LOWER(name), LOWER($2)) DESC,
+		   ts_rank(search_vector, to_tsquery('english', $1)) + word_similarity($2, name) DESC,
+		   name
+		 LIMIT $3`,
+		prefix, q, limit,
+	)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch suggestions"})
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s ProductSuggestion
+		if err := rows.Scan(&s.ID, &s.Name, &s.ImageURL, &s.Highlight); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to scan suggestion"})
+		}
+		suggestions = append(suggestions, s)
+	}
+
+	return c.JSON(ProductSuggestionsResponse{Suggestions: suggestions})
+}
+
 func (h *ProductHandler) GetProduct(c *fiber.Ctx) error {
 	productID := c.Params("id")
 	productUUID, err := uuid.Parse(productID)
@@ -120,19 +308,26 @@ func (h *ProductHandler) GetProduct(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "invalid product id"})
 	}
 
+	target, rates, ferr := catalogCurrency(c, h.DB)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
+
 	var p models.Product
-	err = h.DB.QueryRow(
+	err = scanProduct(h.DB.QueryRow(
 		c.Context(),
-		`SELECT id, name, description, price_cents, currency, image_url, stock, is_active, created_at, updated_at 
-		 FROM products WHERE id = $1`,
+		`SELECT `+productColumns+` FROM products WHERE id = $1`,
 		productUUID,
-	).Scan(
-		&p.ID, &p.Name, &p.Description, &p.PriceCents, &p.Currency,
-		&p.ImageURL, &p.Stock, &p.IsActive, &p.CreatedAt, &p.UpdatedAt,
-	)
+	), &p)
 	if err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "product not found"})
 	}
+	if err := loadProductVariants(c.Context(), h.DB, &p); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch variants"})
+	}
+	if target != "" {
+		localizeProduct(&p, rates, target)
+	}
 
 	return c.JSON(p)
 }
@@ -144,7 +339,18 @@ type CreateProductRequest struct {
 	Currency    string `json:"currency"`
 	ImageURL    string `json:"image_url"`
 	Stock       int    `json:"stock"`
+	WeightGrams int    `json:"weight_grams"`
+	LengthMM    int    `json:"length_mm"`
+	WidthMM     int    `json:"width_mm"`
+	HeightMM    int    `json:"height_mm"`
+	TaxClass    string `json:"tax_class"`
 	IsActive    bool   `json:"is_active"`
+	// Prices replaces the explicit prices in other currencies; leaving it
+	// out keeps the current ones.
+	Prices []models.ProductPrice `json:"prices"`
+	// CategoryIDs replaces the product's categories; leaving it out keeps
+	// the current ones.
+	CategoryIDs []string `json:"category_ids"`
 }
 
 func (h *ProductHandler) CreateProduct(c *fiber.Ctx) error {
@@ -162,26 +368,68 @@ func (h *ProductHandler) CreateProduct(c *fiber.Ctx) error {
 	if req.Stock < 0 {
 		return c.Status(400).JSON(fiber.Map{"error": "stock must be non-negative"})
 	}
+	if req.WeightGrams < 0 || req.LengthMM < 0 || req.WidthMM < 0 || req.HeightMM < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "weight and dimensions must be non-negative"})
+	}
 
 	if req.Currency == "" {
 		req.Currency = "usd"
 	}
+	if ferr := validateProductCurrencies(c.Context(), h.DB, &req.Currency, req.Prices); ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
 
-	var product models.Product
-	err := h.DB.QueryRow(
+	req.TaxClass = strings.ToLower(strings.TrimSpace(req.TaxClass))
+	if req.TaxClass == "" {
+		req.TaxClass = tax.DefaultClass
+	}
+	if !taxClassPattern.MatchString(req.TaxClass) {
+		return c.Status(400).JSON(fiber.Map{"error": "tax_class must be 1-50 lowercase letters, digits, '-' or '_'"})
+	}
+	categoryIDs, err := parseUUIDs(req.CategoryIDs)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid category id"})
+	}
+
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+	}
+	defer tx.Rollback(c.Context())
+
+	var productUUID uuid.UUID
+	err = tx.QueryRow(
 		c.Context(),
-		`INSERT INTO products (name, description, price_cents, currency, image_url, stock, is_active) 
-		 VALUES ($1, $2, $3, $4, $5, $6, $7) 
-		 RETURNING id, name, description, price_cents, currency, image_url, stock, is_active, created_at, updated_at`,
-		req.Name, req.Description, req.PriceCents, req.Currency, req.ImageURL, req.Stock, req.IsActive,
-	).Scan(
-		&product.ID, &product.Name, &product.Description, &product.PriceCents, &product.Currency,
-		&product.ImageURL, &product.Stock, &product.IsActive, &product.CreatedAt, &product.UpdatedAt,
-	)
+		`INSERT INTO products (name, description, price_cents, currency, image_url, stock, weight_grams, length_mm, width_mm, height_mm, tax_class, is_active) 
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) 
+		 RETURNING id`,
+		req.Name, req.Description, req.PriceCents, req.Currency, req.ImageURL, req.Stock,
+		req.WeightGrams, req.LengthMM, req.WidthMM, req.HeightMM, req.TaxClass, req.IsActive,
+	).Scan(&productUUID)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "failed to create product"})
 	}
 
+	if err := replaceProductPrices(c.Context(), tx, productUUID, req.Prices); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to save prices"})
+	}
+
+	if err := replaceProductCategories(c.Context(), tx, productUUID, categoryIDs); err != nil {
+		return productCategoriesError(c, err)
+	}
+
+	var product models.Product
+	err = scanProduct(tx.QueryRow(c.Context(), `SELECT `+productColumns+` FROM products WHERE id = $1`, productUUID), &product)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch product"})
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+	}
+
+	middleware.SetAudit(c, "", "product", product.ID.String(), nil, product)
+
 	return c.Status(201).JSON(product)
 }
 
@@ -192,7 +440,18 @@ type UpdateProductRequest struct {
 	Currency    string `json:"currency"`
 	ImageURL    string `json:"image_url"`
 	Stock       int    `json:"stock"`
+	WeightGrams int    `json:"weight_grams"`
+	LengthMM    int    `json:"length_mm"`
+	WidthMM     int    `json:"width_mm"`
+	HeightMM    int    `json:"height_mm"`
+	TaxClass    string `json:"tax_class"`
 	IsActive    bool   `json:"is_active"`
+	// Prices replaces the explicit prices in other currencies; leaving it
+	// out keeps the current ones.
+	Prices []models.ProductPrice `json:"prices"`
+	// CategoryIDs replaces the product's categories; leaving it out keeps
+	// the current ones.
+	CategoryIDs []string `json:"category_ids"`
 }
 
 func (h *ProductHandler) UpdateProduct(c *fiber.Ctx) error {
@@ -216,27 +475,82 @@ func (h *ProductHandler) UpdateProduct(c *fiber.Ctx) error {
 	if req.Stock < 0 {
 		return c.Status(400).JSON(fiber.Map{"error": "stock must be non-negative"})
 	}
+	if req.WeightGrams < 0 || req.LengthMM < 0 || req.WidthMM < 0 || req.HeightMM < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "weight and dimensions must be non-negative"})
+	}
 
 	if req.Currency == "" {
 		req.Currency = "usd"
 	}
+	if ferr := validateProductCurrencies(c.Context(), h.DB, &req.Currency, req.Prices); ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
 
-	var product models.Product
-	err = h.DB.QueryRow(
+	req.TaxClass = strings.ToLower(strings.TrimSpace(req.TaxClass))
+	if req.TaxClass == "" {
+		req.TaxClass = tax.DefaultClass
+	}
+	if !taxClassPattern.MatchString(req.TaxClass) {
+		return c.Status(400).JSON(fiber.Map{"error": "tax_class must be 1-50 lowercase letters, digits, '-' or '_'"})
+	}
+	categoryIDs, err := parseUUIDs(req.CategoryIDs)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid category id"})
+	}
+
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+	}
+	defer tx.Rollback(c.Context())
+
+	var before models.Product
+	err = scanProduct(tx.QueryRow(
+		c.Context(),
+		`SELECT `+productColumns+` FROM products WHERE id = $1 FOR UPDATE`,
+		productUUID,
+	), &before)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "product not found"})
+	}
+
+	_, err = tx.Exec(
 		c.Context(),
 		`UPDATE products 
-		 SET name = $1, description = $2, price_cents = $3, currency = $4, image_url = $5, stock = $6, is_active = $7, updated_at = CURRENT_TIMESTAMP 
-		 WHERE id = $8 
-		 RETURNING id, name, description, price_cents, currency, image_url, stock, is_active, created_at, updated_at`,
-		req.Name, req.Description, req.PriceCents, req.Currency, req.ImageURL, req.Stock, req.IsActive, productUUID,
-	).Scan(
-		&product.ID, &product.Name, &product.Description, &product.PriceCents, &product.Currency,
-		&product.ImageURL, &product.Stock, &product.IsActive, &product.CreatedAt, &product.UpdatedAt,
+		 SET name = $1, description = $2, price_cents = $3, currency = $4, image_url = $5, stock = $6,
+		   weight_grams = $7, length_mm = $8, width_mm = $9, height_mm = $10, tax_class = $11, is_active = $12, updated_at = CURRENT_TIMESTAMP 
+		 WHERE id = $13`,
+		req.Name, req.Description, req.PriceCents, req.Currency, req.ImageURL, req.Stock,
+		req.WeightGrams, req.LengthMM, req.WidthMM, req.HeightMM, req.TaxClass, req.IsActive, productUUID,
 	)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "failed to update product"})
 	}
 
+	if req.Prices != nil {
+		if err := replaceProductPrices(c.Context(), tx, productUUID, req.Prices); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to save prices"})
+		}
+	}
+
+	if req.CategoryIDs != nil {
+		if err := replaceProductCategories(c.Context(), tx, productUUID, categoryIDs); err != nil {
+			return productCategoriesError(c, err)
+		}
+	}
+
+	var product models.Product
+	err = scanProduct(tx.QueryRow(c.Context(), `SELECT `+productColumns+` FROM products WHERE id = $1`, productUUID), &product)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch product"})
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+	}
+
+	middleware.SetAudit(c, "", "product", product.ID.String(), before, product)
+
 	return c.JSON(product)
 }
 
@@ -247,10 +561,93 @@ func (h *ProductHandler) DeleteProduct(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "invalid product id"})
 	}
 
-	_, err = h.DB.Exec(c.Context(), "DELETE FROM products WHERE id = $1", productUUID)
+	var product models.Product
+	err = scanProduct(h.DB.QueryRow(c.Context(), "DELETE FROM products WHERE id = $1 RETURNING "+productColumns, productUUID), &product)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "product not found"})
+		}
 		return c.Status(500).JSON(fiber.Map{"error": "failed to delete product"})
 	}
 
+	middleware.SetAudit(c, "", "product", product.ID.String(), product, nil)
+
 	return c.JSON(fiber.Map{"message": "product deleted"})
 }
+
+// validateProductCurrencies normalizes the product currency and its explicit
+// prices, which must all be supported currencies.
+func validateProductCurrencies(ctx context.Context, db querier, productCurrency *string, prices []models.ProductPrice) *fiber.Error {
+	rates, err := exchangeRates(ctx, db)
+	if err != nil {
+		return fiber.NewError(500, "failed to fetch exchange rates")
+	}
+
+	code, ferr := supportedCurrency(rates, *productCurrency)
+	if ferr != nil {
+		return ferr
+	}
+	*productCurrency = code
+
+	seen := map[string]bool{}
+	for i := range prices {
+		code, ferr := supportedCurrency(rates, prices[i].Currency)
+		if ferr != nil {
+			return ferr
+		}
+		if code == "" {
+			return fiber.NewError(400, "prices need a currency")
+		}
+		if code == *productCurrency || seen[code] {
+			return fiber.NewError(400, "prices must not repeat a currency or the product's own currency")
+		}
+		if prices[i].PriceCents < 0 {
+			return fiber.NewError(400, "price_cents must be positive")
+		}
+		seen[code] = true
+		prices[i].Currency = code
+	}
+	return nil
+}
+
+func replaceProductPrices(ctx context.Context, db querier, productID uuid.UUID, prices []models.ProductPrice) error {
+	if _, err := db.Exec(ctx, `DELETE FROM product_prices WHERE product_id = $1`, productID); err != nil {
+		return err
+	}
+	for _, p := range prices {
+		_, err := db.Exec(
+			ctx,
+			`INSERT INTO product_prices (product_id, currency, price_cents) VALUES ($1, $2, $3)`,
+			productID, p.Currency, p.PriceCents,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func replaceProductCategories(ctx context.Context, db querier, productID uuid.UUID, categoryIDs []uuid.UUID) error {
+	if _, err := db.Exec(ctx, `DELETE FROM product_categories WHERE product_id = $1`, productID); err != nil {
+		return err
+	}
+	for _, id := range categoryIDs {
+		_, err := db.Exec(
+			ctx,
+			`INSERT INTO product_categories (product_id, category_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+			productID, id,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func productCategoriesError(c *fiber.Ctx, err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+		return c.Status(400).JSON(fiber.Map{"error": "unknown category id"})
+	}
+	return c.Status(500).JSON(fiber.Map{"error": "failed to save categories"})
+}
@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Biz0n58/Zaria/backend/currency"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// Facets of the product listing. Conditions tagged with a facet are left
+// out when counting that facet, so shoppers see what else they could pick.
+const (
+	facetCategory = "category"
+	facetPrice    = "price"
+	facetInStock  = "in_stock"
+	facetOption   = "option"
+)
+
+type ProductFacets struct {
+	Categories []CategoryFacet `json:"categories"`
+	Options    []OptionFacet   `json:"options"`
+	// Price is only counted for listings priced in one currency.
+	Price *PriceFacet `json:"price,omitempty"`
+	// InStock counts the matching products that can be sold right now.
+	InStock int `json:"in_stock"`
+}
+
+// CategoryFacet counts the matching products in a category, including its
+// subcategories.
+type CategoryFacet struct {
+	ID       uuid.UUID  `json:"id"`
+	ParentID *uuid.UUID `json:"parent_id"`
+	Name     string     `json:"name"`
+	Slug     string     `json:"slug"`
+	Count    int        `json:"count"`
+}
+
+// OptionFacet counts, for each value of a variant option, the matching
+// products with an active variant having it.
+type OptionFacet struct {
+	Name   string       `json:"name"`
+	Values []FacetValue `json:"values"`
+}
+
+type FacetValue struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// PriceFacet is the range of listing prices, nil when nothing is priced.
+type PriceFacet struct {
+	Currency string `json:"currency"`
+	MinCents *int   `json:"min_cents"`
+	MaxCents *int   `json:"max_cents"`
+}
+
+// listingPriceSQL is a product's price in target as the listing shows it:
+// its own price, its explicit price in target, or its own price converted
+// with rates. Products that cannot be priced in target have no price.
+func listingPriceSQL(args *sqlArgs, rates currency.Rates, target string) string {
+	codes := []string{rates.Base}
+	for code := range rates.Rates {
+		if code != rates.Base {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+
+	convert := ``
+	for _, code := range codes {
+		factor, ok := rates.Factor(code, target)
+		if !ok || code == target {
+			continue
+		}
+		convert += ` WHEN ` + args.add(code) + ` THEN ROUND(products.price_cents * ` + args.add(factor) + `::numeric)::int`
+	}
+	if convert == `` {
+		convert = `NULL::int`
+	} else {
+		convert = `CASE products.currency` + convert + ` END`
+	}
+
+	t := args.add(target)
+	return `CASE WHEN products.currency = ` + t + ` THEN products.price_cents
+	  ELSE COALESCE((SELECT pp.price_cents FROM product_prices pp WHERE pp.product_id = products.id AND pp.currency = ` + t + `),
+	    ` + convert + `) END`
+}
+
+// priceBound reads an optional price filter, in the minor unit of the
+// listing currency.
+func priceBound(c *fiber.Ctx, key string) (*int, *fiber.Error) {
+	raw := c.Query(key)
+	if raw == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		return nil, fiber.NewError(400, key+" must be a non-negative integer")
+	}
+	return &n, nil
+}
+
+// optionFilter selects products with a variant having one of values for
+// the option called name.
+type optionFilter struct {
+	name   string
+	values []string
+}
+
+// parseOptionFilters reads repeated ?option=name:value parameters. Values
+// given for the same option are alternatives.
+func parseOptionFilters(c *fiber.Ctx) ([]optionFilter, *fiber.Error) {
+	var filters []optionFilter
+	index := map[string]int{}
+	for _, raw := range c.Context().QueryArgs().PeekMulti("option") {
+		name, value, ok := strings.Cut(string(raw), ":")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || name == "" || value == "" {
+			return nil, fiber.NewError(400, "option must be name:value")
+		}
+		i, seen := index[name]
+		if !seen {
+			i = len(filters)
+			index[name] = i
+			filters = append(filters, optionFilter{name: name})
+		}
+		filters[i].values = append(filters[i].values, value)
+	}
+	return filters, nil
+}
+
+// variantOptionSQL matches when the variant aliased variant has one of the
+// values of f.
+func variantOptionSQL(args *sqlArgs, variant string, f optionFilter) string {
+	return `EXISTS (SELECT 1 FROM product_variant_options fvo JOIN product_options fo ON fo.id = fvo.option_id
+	  WHERE fvo.variant_id = ` + variant + `.id AND fo.name = ` + args.add(f.name) + ` AND fvo.value = ANY(` + args.add(f.values) + `))`
+}
+
+// optionsCondition matches products with an active variant satisfying every
+// option filter, so Size M and Color Red select an M that comes in red.
+func optionsCondition(filters []optionFilter) sqlFragment {
+	return func(args *sqlArgs) string {
+		conds := []string{`fv.product_id = products.id`, `fv.is_active`}
+		for _, f := range filters {
+			conds = append(conds, variantOptionSQL(args, "fv", f))
+		}
+		return `EXISTS (SELECT 1 FROM product_variants fv WHERE ` + strings.Join(conds, ` AND `) + `)`
+	}
+}
+
+// productOrderSQL renders the ORDER BY clause for ?sort=, or reports false
+// for an unknown sort. Without a sort, searches are ordered by relevance
+// and other listings by last update. Popularity is the number of units
+// sold in paid and shipped orders.
+func productOrderSQL(args *sqlArgs, sortBy, search string, price sqlFragment) (string, bool) {
+	switch sortBy {
+	case "", "relevance":
+		if search == "" {
+			return ` ORDER BY updated_at DESC, id`, true
+		}
+		return ` ORDER BY ` + searchRankSQL(args.add(search)) + ` DESC, updated_at DESC, id`, true
+	case "newest":
+		return ` ORDER BY created_at DESC, id`, true
+	case "price_asc":
+		return ` ORDER BY ` + price(args) + ` ASC NULLS LAST, id`, true
+	case "price_desc":
+		return ` ORDER BY ` + price(args) + ` DESC NULLS LAST, id`, true
+	case "name_asc":
+		return ` ORDER BY LOWER(name), id`, true
+	case "name_desc":
+		return ` ORDER BY LOWER(name) DESC, id`, true
+	case "popularity":
+		return ` ORDER BY (SELECT COALESCE(SUM(oi.qty), 0) FROM order_items oi JOIN orders o ON o.id = oi.order_id
+		   WHERE oi.product_id = products.id AND o.status IN ('paid', 'shipped')) DESC, updated_at DESC, id`, true
+	}
+	return "", false
+}
+
+// productFacets counts the products matching where for every facet. The
+// price range is left out when priceCurrency is "".
+func productFacets(ctx context.Context, db querier, where *sqlWhere, price sqlFragment, options []optionFilter, priceCurrency string) (ProductFacets, error) {
+	var facets ProductFacets
+
+	var err error
+	if facets.Categories, err = categoryFacets(ctx, db, where); err != nil {
+		return facets, err
+	}
+	if facets.Options, err = optionFacets(ctx, db, where, options); err != nil {
+		return facets, err
+	}
+
+	if priceCurrency != "" {
+		facets.Price = &PriceFacet{Currency: priceCurrency}
+		var args sqlArgs
+		priceSQL := price(&args)
+		query := `SELECT MIN(price), MAX(price) FROM (
+		   SELECT ` + priceSQL + ` AS price FROM products` + where.build(&args, skipFacet(facetPrice)) + `
+		 ) prices`
+		err = db.QueryRow(ctx, query, args.values...).Scan(&facets.Price.MinCents, &facets.Price.MaxCents)
+		if err != nil {
+			return facets, err
+		}
+	}
+
+	var args sqlArgs
+	query := `SELECT COUNT(*) FILTER (WHERE (` + productStockSQL + `) > 0) FROM products` +
+		where.build(&args, skipFacet(facetInStock))
+	err = db.QueryRow(ctx, query, args.values...).Scan(&facets.InStock)
+	return facets, err
+}
+
+func categoryFacets(ctx context.Context, db querier, where *sqlWhere) ([]CategoryFacet, error) {
+	var args sqlArgs
+	rows, err := db.Query(
+		ctx,
+		`WITH RECURSIVE matched AS (
+		   SELECT id FROM products`+where.build(&args, skipFacet(facetCategory))+`
+		 ), ancestry AS (
+		   SELECT id, id AS ancestor_id FROM categories
+		   UNION ALL
+		   SELECT a.id, c.parent_id FROM ancestry a JOIN categories c ON c.id = a.ancestor_id WHERE c.parent_id IS NOT NULL
+		 )
+		 SELECT cat.id, cat.parent_id, cat.name, cat.slug, COUNT(DISTINCT pc.product_id)
+		 FROM categories cat
+		 JOIN ancestry a ON a.ancestor_id = cat.id
+		 JOIN product_categories pc ON pc.category_id = a.id
+		 JOIN matched m ON m.id = pc.product_id
+		 GROUP BY cat.id
+		 ORDER BY cat.position, cat.name`,
+		args.values...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	facets := []CategoryFacet{}
+	for rows.Next() {
+		var f CategoryFacet
+		if err := rows.Scan(&f.ID, &f.ParentID, &f.Name, &f.Slug, &f.Count); err != nil {
+			return nil, err
+		}
+		facets = append(facets, f)
+	}
+	return facets, rows.Err()
+}
+
+// optionFacets counts the values of every option with the other selected
+// options still applied, on the same variant.
+func optionFacets(ctx context.Context, db querier, where *sqlWhere, options []optionFilter) ([]OptionFacet, error) {
+	var args sqlArgs
+	query := `SELECT o.name, vo.value, COUNT(DISTINCT v.product_id)
+		 FROM product_variants v
+		 JOIN product_variant_options vo ON vo.variant_id = v.id
+		 JOIN product_options o ON o.id = vo.option_id
+		 WHERE v.is_active AND v.product_id IN (SELECT id FROM products` + where.build(&args, skipFacet(facetOption)) + `)`
+	for _, f := range options {
+		query += ` AND (o.name = ` + args.add(f.name) + ` OR ` + variantOptionSQL(&args, "v", f) + `)`
+	}
+	query += ` GROUP BY o.name, vo.value
+		 ORDER BY MIN(o.position), o.name, MIN(array_position(o.option_values, vo.value)), vo.value`
+
+	rows, err := db.Query(ctx, query, args.values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	facets := []OptionFacet{}
+	index := map[string]int{}
+	for rows.Next() {
+		var name string
+		var value FacetValue
+		if err := rows.Scan(&name, &value.Value, &value.Count); err != nil {
+			return nil, err
+		}
+		i, seen := index[name]
+		if !seen {
+			i = len(facets)
+			index[name] = i
+			facets = append(facets, OptionFacet{Name: name})
+		}
+		facets[i].Values = append(facets[i].Values, value)
+	}
+	return facets, rows.Err()
+}
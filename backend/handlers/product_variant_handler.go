@@ -0,0 +1,610 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/Biz0n58/Zaria/backend/middleware"
+	"github.com/Biz0n58/Zaria/backend/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type ProductVariantHandler struct {
+	DB *pgxpool.Pool
+}
+
+func NewProductVariantHandler(db *pgxpool.Pool) *ProductVariantHandler {
+	return &ProductVariantHandler{DB: db}
+}
+
+type ProductOptionRequest struct {
+	Name     string   `json:"name"`
+	Values   []string `json:"values"`
+	Position int      `json:"position"`
+}
+
+type ProductVariantRequest struct {
+	SKU        string  `json:"sku"`
+	PriceCents *int    `json:"price_cents"`
+	Stock      int     `json:"stock"`
+	ImageURL   *string `json:"image_url"`
+	IsActive   bool    `json:"is_active"`
+	Position   int     `json:"position"`
+	// Options maps the name of every product option to this variant's
+	// value, e.g. {"Size": "M", "Color": "Red"}.
+	Options map[string]string `json:"options"`
+}
+
+type ProductOptionsResponse struct {
+	Options []models.ProductOption `json:"options"`
+}
+
+type ProductVariantsResponse struct {
+	Variants []models.ProductVariant `json:"variants"`
+}
+
+func (h *ProductVariantHandler) ListOptions(c *fiber.Ctx) error {
+	productUUID, ferr := h.product(c, h.DB, false)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
+
+	options, err := listProductOptions(c.Context(), h.DB, productUUID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch options"})
+	}
+
+	return c.JSON(ProductOptionsResponse{Options: options})
+}
+
+// CreateOption adds an option to a product. Options cannot be added once
+// the product has variants, since those would have no value for it.
+func (h *ProductVariantHandler) CreateOption(c *fiber.Ctx) error {
+	var req ProductOptionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+	if msg := validateProductOptionRequest(&req); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+	}
+	defer tx.Rollback(c.Context())
+
+	productUUID, ferr := h.product(c, tx, true)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
+
+	var hasVariants bool
+	err = tx.QueryRow(
+		c.Context(),
+		`SELECT EXISTS (SELECT 1 FROM product_variants WHERE product_id = $1)`,
+		productUUID,
+	).Scan(&hasVariants)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch variants"})
+	}
+	if hasVariants {
+		return c.Status(409).JSON(fiber.Map{"error": "options cannot be added while the product has variants"})
+	}
+
+	var option models.ProductOption
+	err = scanProductOption(tx.QueryRow(
+		c.Context(),
+		`INSERT INTO product_options (product_id, name, option_values, position)
+		 VALUES ($1, $2, $3, $4)
+		 RETURNING `+productOptionColumns,
+		productUUID, req.Name, req.Values, req.Position,
+	), &option)
+	if err != nil {
+		return productOptionWriteError(c, err, "failed to create option")
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+	}
+
+	middleware.SetAudit(c, "", "product_option", option.ID.String(), nil, option)
+
+	return c.Status(201).JSON(option)
+}
+
+// UpdateOption renames an option or changes its values; values still used
+// by a variant cannot be removed.
+func (h *ProductVariantHandler) UpdateOption(c *fiber.Ctx) error {
+	optionUUID, err := uuid.Parse(c.Params("option_id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid option id"})
+	}
+
+	var req ProductOptionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+	if msg := validateProductOptionRequest(&req); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+	}
+	defer tx.Rollback(c.Context())
+
+	productUUID, ferr := h.product(c, tx, true)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
+
+	var before models.ProductOption
+	err = scanProductOption(tx.QueryRow(
+		c.Context(),
+		`SELECT `+productOptionColumns+` FROM product_options WHERE id = $1 AND product_id = $2`,
+		optionUUID, productUUID,
+	), &before)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "option not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch option"})
+	}
+
+	var inUse []string
+	err = tx.QueryRow(
+		c.Context(),
+		`SELECT ARRAY(SELECT DISTINCT value FROM product_variant_options
+		              WHERE option_id = $1 AND NOT (value = ANY($2)) ORDER BY value)`,
+		optionUUID, req.Values,
+	).Scan(&inUse)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch variants"})
+	}
+	if len(inUse) > 0 {
+		return c.Status(409).JSON(fiber.Map{"error": "values still used by variants: " + strings.Join(inUse, ", ")})
+	}
+
+	var option models.ProductOption
+	err = scanProductOption(tx.QueryRow(
+		c.Context(),
+		`UPDATE product_options
+		 SET name = $1, option_values = $2, position = $3, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $4
+		 RETURNING `+productOptionColumns,
+		req.Name, req.Values, req.Position, optionUUID,
+	), &option)
+	if err != nil {
+		return productOptionWriteError(c, err, "failed to update option")
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+	}
+
+	middleware.SetAudit(c, "", "product_option", option.ID.String(), before, option)
+
+	return c.JSON(option)
+}
+
+// DeleteOption removes an option that no variant uses.
+func (h *ProductVariantHandler) DeleteOption(c *fiber.Ctx) error {
+	optionUUID, err := uuid.Parse(c.Params("option_id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid option id"})
+	}
+
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+	}
+	defer tx.Rollback(c.Context())
+
+	productUUID, ferr := h.product(c, tx, true)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
+
+	var option models.ProductOption
+	err = scanProductOption(tx.QueryRow(
+		c.Context(),
+		`SELECT `+productOptionColumns+` FROM product_options WHERE id = $1 AND product_id = $2`,
+		optionUUID, productUUID,
+	), &option)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "option not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch option"})
+	}
+
+	var inUse bool
+	err = tx.QueryRow(
+		c.Context(),
+		`SELECT EXISTS (SELECT 1 FROM product_variant_options WHERE option_id = $1)`,
+		optionUUID,
+	).Scan(&inUse)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch variants"})
+	}
+	if inUse {
+		return c.Status(409).JSON(fiber.Map{"error": "option is used by variants"})
+	}
+
+	if _, err := tx.Exec(c.Context(), `DELETE FROM product_options WHERE id = $1`, optionUUID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to delete option"})
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+	}
+
+	middleware.SetAudit(c, "", "product_option", option.ID.String(), option, nil)
+
+	return c.JSON(fiber.Map{"message": "option deleted"})
+}
+
+func (h *ProductVariantHandler) ListVariants(c *fiber.Ctx) error {
+	productUUID, ferr := h.product(c, h.DB, false)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
+
+	variants, err := listProductVariants(c.Context(), h.DB, productUUID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch variants"})
+	}
+
+	return c.JSON(ProductVariantsResponse{Variants: variants})
+}
+
+func (h *ProductVariantHandler) CreateVariant(c *fiber.Ctx) error {
+	var req ProductVariantRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+	if msg := validateProductVariantRequest(&req); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+	}
+	defer tx.Rollback(c.Context())
+
+	productUUID, ferr := h.product(c, tx, true)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
+
+	values, ferr := variantOptionValues(c.Context(), tx, productUUID, uuid.Nil, req.Options)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
+
+	var variantUUID uuid.UUID
+	err = tx.QueryRow(
+		c.Context(),
+		`INSERT INTO product_variants (product_id, sku, price_cents, stock, image_url, is_active, position)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 RETURNING id`,
+		productUUID, req.SKU, req.PriceCents, req.Stock, req.ImageURL, req.IsActive, req.Position,
+	).Scan(&variantUUID)
+	if err != nil {
+		return productVariantWriteError(c, err, "failed to create variant")
+	}
+
+	if err := replaceVariantOptions(c.Context(), tx, variantUUID, values); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to save variant options"})
+	}
+
+	var variant models.ProductVariant
+	err = scanProductVariant(tx.QueryRow(
+		c.Context(),
+		`SELECT `+productVariantColumns+` FROM product_variants v WHERE v.id = $1`,
+		variantUUID,
+	), &variant)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch variant"})
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+	}
+
+	middleware.SetAudit(c, "", "product_variant", variant.ID.String(), nil, variant)
+
+	return c.Status(201).JSON(variant)
+}
+
+func (h *ProductVariantHandler) UpdateVariant(c *fiber.Ctx) error {
+	variantUUID, err := uuid.Parse(c.Params("variant_id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid variant id"})
+	}
+
+	var req ProductVariantRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+	if msg := validateProductVariantRequest(&req); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+	}
+	defer tx.Rollback(c.Context())
+
+	productUUID, ferr := h.product(c, tx, true)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
+
+	var before models.ProductVariant
+	err = scanProductVariant(tx.QueryRow(
+		c.Context(),
+		`SELECT `+productVariantColumns+` FROM product_variants v WHERE v.id = $1 AND v.product_id = $2 FOR UPDATE`,
+		variantUUID, productUUID,
+	), &before)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "variant not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch variant"})
+	}
+
+	values, ferr := variantOptionValues(c.Context(), tx, productUUID, variantUUID, req.Options)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
+
+	_, err = tx.Exec(
+		c.Context(),
+		`UPDATE product_variants
+		 SET sku = $1, price_cents = $2, stock = $3, image_url = $4, is_active = $5, position = $6, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $7`,
+		req.SKU, req.PriceCents, req.Stock, req.ImageURL, req.IsActive, req.Position, variantUUID,
+	)
+	if err != nil {
+		return productVariantWriteError(c, err, "failed to update variant")
+	}
+
+	if err := replaceVariantOptions(c.Context(), tx, variantUUID, values); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to save variant options"})
+	}
+
+	var variant models.ProductVariant
+	err = scanProductVariant(tx.QueryRow(
+		c.Context(),
+		`SELECT `+productVariantColumns+` FROM product_variants v WHERE v.id = $1`,
+		variantUUID,
+	), &variant)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch variant"})
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+	}
+
+	middleware.SetAudit(c, "", "product_variant", variant.ID.String(), before, variant)
+
+	return c.JSON(variant)
+}
+
+// DeleteVariant removes a variant; orders keep its SKU and option values.
+func (h *ProductVariantHandler) DeleteVariant(c *fiber.Ctx) error {
+	variantUUID, err := uuid.Parse(c.Params("variant_id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid variant id"})
+	}
+
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+	}
+	defer tx.Rollback(c.Context())
+
+	productUUID, ferr := h.product(c, tx, true)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
+
+	var variant models.ProductVariant
+	err = scanProductVariant(tx.QueryRow(
+		c.Context(),
+		`SELECT `+productVariantColumns+` FROM product_variants v WHERE v.id = $1 AND v.product_id = $2 FOR UPDATE`,
+		variantUUID, productUUID,
+	), &variant)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "variant not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch variant"})
+	}
+
+	if _, err := tx.Exec(c.Context(), `DELETE FROM product_variants WHERE id = $1`, variantUUID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to delete variant"})
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+	}
+
+	middleware.SetAudit(c, "", "product_variant", variant.ID.String(), variant, nil)
+
+	return c.JSON(fiber.Map{"message": "variant deleted"})
+}
+
+// product parses the :id param and checks the product exists. With lock set
+// the product row is locked, which serializes changes to its options and
+// variants.
+func (h *ProductVariantHandler) product(c *fiber.Ctx, db querier, lock bool) (uuid.UUID, *fiber.Error) {
+	productUUID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return uuid.Nil, fiber.NewError(400, "invalid product id")
+	}
+
+	query := `SELECT id FROM products WHERE id = $1`
+	if lock {
+		query += ` FOR UPDATE`
+	}
+	err = db.QueryRow(c.Context(), query, productUUID).Scan(&productUUID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, fiber.NewError(404, "product not found")
+	}
+	if err != nil {
+		return uuid.Nil, fiber.NewError(500, "failed to fetch product")
+	}
+	return productUUID, nil
+}
+
+// validateProductOptionRequest trims the name and values and returns a
+// message describing the first problem, or "".
+func validateProductOptionRequest(req *ProductOptionRequest) string {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		return "name must be 1-100 characters"
+	}
+	if len(req.Values) == 0 {
+		return "values are required"
+	}
+
+	seen := map[string]bool{}
+	for i, v := range req.Values {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			return "values must not be empty"
+		}
+		if seen[v] {
+			return "values must not repeat"
+		}
+		seen[v] = true
+		req.Values[i] = v
+	}
+	return ""
+}
+
+func validateProductVariantRequest(req *ProductVariantRequest) string {
+	req.SKU = strings.TrimSpace(req.SKU)
+	if req.SKU == "" || len(req.SKU) > 100 {
+		return "sku must be 1-100 characters"
+	}
+	if req.PriceCents != nil && *req.PriceCents < 0 {
+		return "price_cents must be positive"
+	}
+	if req.Stock < 0 {
+		return "stock must be non-negative"
+	}
+	if req.ImageURL != nil && strings.TrimSpace(*req.ImageURL) == "" {
+		req.ImageURL = nil
+	}
+	return ""
+}
+
+// variantOption is the value a variant takes for one option.
+type variantOption struct {
+	OptionID uuid.UUID
+	Value    string
+}
+
+// variantOptionValues checks that options names one allowed value for each
+// option of the product, and that no other variant of the product than
+// variantID already has the same values.
+func variantOptionValues(ctx context.Context, db querier, productID, variantID uuid.UUID, options map[string]string) ([]variantOption, *fiber.Error) {
+	productOptions, err := listProductOptions(ctx, db, productID)
+	if err != nil {
+		return nil, fiber.NewError(500, "failed to fetch options")
+	}
+	if len(options) != len(productOptions) {
+		return nil, fiber.NewError(400, "options must give a value for each of the product's options")
+	}
+
+	values := make([]variantOption, 0, len(productOptions))
+	for _, o := range productOptions {
+		value, ok := options[o.Name]
+		if !ok {
+			return nil, fiber.NewError(400, "options must give a value for "+o.Name)
+		}
+		value = strings.TrimSpace(value)
+		if !slices.Contains(o.Values, value) {
+			return nil, fiber.NewError(400, value+" is not a value of "+o.Name)
+		}
+		values = append(values, variantOption{OptionID: o.ID, Value: value})
+	}
+
+	variants, err := listProductVariants(ctx, db, productID)
+	if err != nil {
+		return nil, fiber.NewError(500, "failed to fetch variants")
+	}
+	key := variantKey(options)
+	for _, v := range variants {
+		if v.ID == variantID {
+			continue
+		}
+		other := make(map[string]string, len(v.Options))
+		for _, o := range v.Options {
+			other[o.Option] = o.Value
+		}
+		if variantKey(other) == key {
+			return nil, fiber.NewError(409, "another variant ("+v.SKU+") has the same options")
+		}
+	}
+
+	return values, nil
+}
+
+// variantKey identifies a combination of option values.
+func variantKey(options map[string]string) string {
+	parts := make([]string, 0, len(options))
+	for name, value := range options {
+		parts = append(parts, name+"\x00"+strings.TrimSpace(value))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "\x01")
+}
+
+func replaceVariantOptions(ctx context.Context, db querier, variantID uuid.UUID, values []variantOption) error {
+	if _, err := db.Exec(ctx, `DELETE FROM product_variant_options WHERE variant_id = $1`, variantID); err != nil {
+		return err
+	}
+	for _, v := range values {
+		_, err := db.Exec(
+			ctx,
+			`INSERT INTO product_variant_options (variant_id, option_id, value) VALUES ($1, $2, $3)`,
+			variantID, v.OptionID, v.Value,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func productOptionWriteError(c *fiber.Ctx, err error, fallback string) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return c.Status(409).JSON(fiber.Map{"error": "the product already has an option with this name"})
+	}
+	return c.Status(500).JSON(fiber.Map{"error": fallback})
+}
+
+func productVariantWriteError(c *fiber.Ctx, err error, fallback string) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return c.Status(409).JSON(fiber.Map{"error": "a variant with this sku already exists"})
+	}
+	return c.Status(500).JSON(fiber.Map{"error": fallback})
+}
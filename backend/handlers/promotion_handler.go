@@ -0,0 +1,379 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/Biz0n58/Zaria/backend/middleware"
+	"github.com/Biz0n58/Zaria/backend/models"
+	"github.com/Biz0n58/Zaria/backend/pricing"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type PromotionHandler struct {
+	DB *pgxpool.Pool
+}
+
+func NewPromotionHandler(db *pgxpool.Pool) *PromotionHandler {
+	return &PromotionHandler{DB: db}
+}
+
+var promoCodePattern = regexp.MustCompile(`^[A-Z0-9_-]{3,50}$`)
+
+type PromotionRequest struct {
+	Code             string     `json:"code"`
+	Description      string     `json:"description"`
+	Type             string     `json:"type"`
+	Value            int        `json:"value"`
+	Scope            string     `json:"scope"`
+	ProductIDs       []string   `json:"product_ids"`
+	CategoryIDs      []string   `json:"category_ids"`
+	MinSubtotalCents int        `json:"min_subtotal_cents"`
+	UsageLimit       *int       `json:"usage_limit"`
+	PerCustomerLimit *int       `json:"per_customer_limit"`
+	StartsAt         *time.Time `json:"starts_at"`
+	EndsAt           *time.Time `json:"ends_at"`
+	IsActive         bool       `json:"is_active"`
+}
+
+type PromotionsResponse struct {
+	Promotions []models.Promotion `json:"promotions"`
+	Total      int                `json:"total"`
+	Page       int                `json:"page"`
+	Limit      int                `json:"limit"`
+}
+
+func (h *PromotionHandler) ListPromotions(c *fiber.Ctx) error {
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "50"))
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+	offset := (page - 1) * limit
+
+	var total int
+	if err := h.DB.QueryRow(c.Context(), `SELECT COUNT(*) FROM promotions`).Scan(&total); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to count promotions"})
+	}
+
+	rows, err := h.DB.Query(
+		c.Context(),
+		`SELECT `+promotionColumns+` FROM promotions p ORDER BY p.created_at DESC LIMIT $1 OFFSET $2`,
+		limit, offset,
+	)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch promotions"})
+	}
+	defer rows.Close()
+
+	promotions := []models.Promotion{}
+	for rows.Next() {
+		var p models.Promotion
+		if err := scanPromotion(rows, &p); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to scan promotion"})
+		}
+		promotions = append(promotions, p)
+	}
+
+	return c.JSON(PromotionsResponse{
+		Promotions: promotions,
+		Total:      total,
+		Page:       page,
+		Limit:      limit,
+	})
+}
+
+func (h *PromotionHandler) GetPromotion(c *fiber.Ctx) error {
+	promotionUUID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid promotion id"})
+	}
+
+	promotion, err := loadPromotion(c.Context(), h.DB, promotionUUID, false)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "promotion not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch promotion"})
+	}
+
+	return c.JSON(promotion)
+}
+
+func (h *PromotionHandler) CreatePromotion(c *fiber.Ctx) error {
+	var req PromotionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+	productIDs, categoryIDs, msg := validatePromotionRequest(&req)
+	if msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+	}
+	defer tx.Rollback(c.Context())
+
+	var promotionID uuid.UUID
+	err = tx.QueryRow(
+		c.Context(),
+		`INSERT INTO promotions (code, description, type, value, scope, min_subtotal_cents, usage_limit, per_customer_limit, starts_at, ends_at, is_active)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		 RETURNING id`,
+		req.Code, req.Description, req.Type, req.Value, req.Scope, req.MinSubtotalCents,
+		req.UsageLimit, req.PerCustomerLimit, req.StartsAt, req.EndsAt, req.IsActive,
+	).Scan(&promotionID)
+	if err != nil {
+		return promotionWriteError(c, err, "failed to create promotion")
+	}
+
+	if err := replacePromotionTargets(c.Context(), tx, promotionID, productIDs, categoryIDs); err != nil {
+		return promotionWriteError(c, err, "failed to create promotion")
+	}
+
+	promotion, err := loadPromotion(c.Context(), tx, promotionID, false)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch promotion"})
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+	}
+
+	middleware.SetAudit(c, "", "promotion", promotion.ID.String(), nil, promotion)
+
+	return c.Status(201).JSON(promotion)
+}
+
+func (h *PromotionHandler) UpdatePromotion(c *fiber.Ctx) error {
+	promotionUUID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid promotion id"})
+	}
+
+	var req PromotionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+	productIDs, categoryIDs, msg := validatePromotionRequest(&req)
+	if msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+	}
+	defer tx.Rollback(c.Context())
+
+	before, err := loadPromotion(c.Context(), tx, promotionUUID, true)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "promotion not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch promotion"})
+	}
+
+	_, err = tx.Exec(
+		c.Context(),
+		`UPDATE promotions SET code = $1, description = $2, type = $3, value = $4, scope = $5,
+		   min_subtotal_cents = $6, usage_limit = $7, per_customer_limit = $8, starts_at = $9, ends_at = $10,
+		   is_active = $11, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $12`,
+		req.Code, req.Description, req.Type, req.Value, req.Scope, req.MinSubtotalCents,
+		req.UsageLimit, req.PerCustomerLimit, req.StartsAt, req.EndsAt, req.IsActive, promotionUUID,
+	)
+	if err != nil {
+		return promotionWriteError(c, err, "failed to update promotion")
+	}
+
+	if err := replacePromotionTargets(c.Context(), tx, promotionUUID, productIDs, categoryIDs); err != nil {
+		return promotionWriteError(c, err, "failed to update promotion")
+	}
+
+	promotion, err := loadPromotion(c.Context(), tx, promotionUUID, false)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch promotion"})
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+	}
+
+	middleware.SetAudit(c, "", "promotion", promotion.ID.String(), before, promotion)
+
+	return c.JSON(promotion)
+}
+
+// DeletePromotion removes the code. Orders that used it keep their discount
+// and the code snapshot in order_promotions.
+func (h *PromotionHandler) DeletePromotion(c *fiber.Ctx) error {
+	promotionUUID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid promotion id"})
+	}
+
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+	}
+	defer tx.Rollback(c.Context())
+
+	before, err := loadPromotion(c.Context(), tx, promotionUUID, true)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "promotion not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch promotion"})
+	}
+
+	if _, err := tx.Exec(c.Context(), `DELETE FROM promotions WHERE id = $1`, promotionUUID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to delete promotion"})
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+	}
+
+	middleware.SetAudit(c, "", "promotion", promotionUUID.String(), before, nil)
+
+	return c.JSON(fiber.Map{"message": "promotion deleted"})
+}
+
+func loadPromotion(ctx context.Context, db querier, promotionID uuid.UUID, lock bool) (models.Promotion, error) {
+	query := `SELECT ` + promotionColumns + ` FROM promotions p WHERE p.id = $1`
+	if lock {
+		query += ` FOR UPDATE OF p`
+	}
+
+	var p models.Promotion
+	err := scanPromotion(db.QueryRow(ctx, query, promotionID), &p)
+	return p, err
+}
+
+// validatePromotionRequest normalizes req and parses its targets. It returns
+// a message describing the first problem, or "" if the request is valid.
+func validatePromotionRequest(req *PromotionRequest) ([]uuid.UUID, []uuid.UUID, string) {
+	req.Code = normalizePromoCode(req.Code)
+	if !promoCodePattern.MatchString(req.Code) {
+		return nil, nil, "code must be 3-50 letters, digits, '-' or '_'"
+	}
+
+	switch req.Type {
+	case pricing.PromotionPercentage:
+		if req.Value < 1 || req.Value > 100 {
+			return nil, nil, "value must be a percentage between 1 and 100"
+		}
+	case pricing.PromotionFixedAmount:
+		if req.Value < 1 {
+			return nil, nil, "value must be a positive amount in cents"
+		}
+	case pricing.PromotionFreeShipping:
+		req.Value = 0
+	default:
+		return nil, nil, "type must be percentage, fixed_amount or free_shipping"
+	}
+
+	if req.Scope == "" {
+		req.Scope = pricing.ScopeOrder
+	}
+
+	productIDs, err := parseUUIDs(req.ProductIDs)
+	if err != nil {
+		return nil, nil, "invalid product id"
+	}
+	categoryIDs, err := parseUUIDs(req.CategoryIDs)
+	if err != nil {
+		return nil, nil, "invalid category id"
+	}
+
+	switch req.Scope {
+	case pricing.ScopeOrder:
+		if len(productIDs) > 0 || len(categoryIDs) > 0 {
+			return nil, nil, "product_ids and category_ids require scope products or categories"
+		}
+	case pricing.ScopeProducts:
+		if len(productIDs) == 0 || len(categoryIDs) > 0 {
+			return nil, nil, "scope products requires product_ids only"
+		}
+	case pricing.ScopeCategories:
+		if len(categoryIDs) == 0 || len(productIDs) > 0 {
+			return nil, nil, "scope categories requires category_ids only"
+		}
+	default:
+		return nil, nil, "scope must be order, products or categories"
+	}
+
+	if req.MinSubtotalCents < 0 {
+		return nil, nil, "min_subtotal_cents must be non-negative"
+	}
+	if req.UsageLimit != nil && *req.UsageLimit < 1 {
+		return nil, nil, "usage_limit must be at least 1"
+	}
+	if req.PerCustomerLimit != nil && *req.PerCustomerLimit < 1 {
+		return nil, nil, "per_customer_limit must be at least 1"
+	}
+	if req.StartsAt != nil && req.EndsAt != nil && !req.EndsAt.After(*req.StartsAt) {
+		return nil, nil, "ends_at must be after starts_at"
+	}
+
+	return productIDs, categoryIDs, ""
+}
+
+func replacePromotionTargets(ctx context.Context, db querier, promotionID uuid.UUID, productIDs, categoryIDs []uuid.UUID) error {
+	if _, err := db.Exec(ctx, `DELETE FROM promotion_products WHERE promotion_id = $1`, promotionID); err != nil {
+		return err
+	}
+	if _, err := db.Exec(ctx, `DELETE FROM promotion_categories WHERE promotion_id = $1`, promotionID); err != nil {
+		return err
+	}
+
+	for _, id := range productIDs {
+		_, err := db.Exec(
+			ctx,
+			`INSERT INTO promotion_products (promotion_id, product_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+			promotionID, id,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	for _, id := range categoryIDs {
+		_, err := db.Exec(
+			ctx,
+			`INSERT INTO promotion_categories (promotion_id, category_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+			promotionID, id,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func promotionWriteError(c *fiber.Ctx, err error, fallback string) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "23505":
+			return c.Status(409).JSON(fiber.Map{"error": "a promotion with this code already exists"})
+		case "23503":
+			return c.Status(400).JSON(fiber.Map{"error": "unknown product or category id"})
+		}
+	}
+	return c.Status(500).JSON(fiber.Map{"error": fallback})
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/Biz0n58/Zaria/backend/models"
+	"github.com/Biz0n58/Zaria/backend/pricing"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const promotionColumns = `p.id, p.code, p.description, p.type, p.value, p.scope,
+	ARRAY(SELECT product_id::text FROM promotion_products WHERE promotion_id = p.id),
+	ARRAY(SELECT category_id::text FROM promotion_categories WHERE promotion_id = p.id),
+	p.min_subtotal_cents, p.usage_limit, p.per_customer_limit, p.starts_at, p.ends_at, p.is_active,
+	(SELECT COUNT(*) FROM order_promotions op JOIN orders o ON o.id = op.order_id
+	 WHERE op.promotion_id = p.id AND o.status NOT IN ('cancelled', 'failed')),
+	p.created_at, p.updated_at`
+
+func scanPromotion(row pgx.Row, p *models.Promotion) error {
+	return scanPromotionWith(row, p)
+}
+
+// scanPromotionWith scans promotionColumns followed by extra columns.
+func scanPromotionWith(row pgx.Row, p *models.Promotion, extra ...any) error {
+	var productIDs, categoryIDs []string
+	dest := []any{
+		&p.ID, &p.Code, &p.Description, &p.Type, &p.Value, &p.Scope,
+		&productIDs, &categoryIDs,
+		&p.MinSubtotalCents, &p.UsageLimit, &p.PerCustomerLimit, &p.StartsAt, &p.EndsAt, &p.IsActive,
+		&p.TimesUsed, &p.CreatedAt, &p.UpdatedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+
+	var err error
+	if p.ProductIDs, err = parseUUIDs(productIDs); err != nil {
+		return err
+	}
+	p.CategoryIDs, err = parseUUIDs(categoryIDs)
+	return err
+}
+
+func parseUUIDs(ids []string) ([]uuid.UUID, error) {
+	out := make([]uuid.UUID, 0, len(ids))
+	for _, s := range ids {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, nil
+}
+
+func normalizePromoCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// checkoutPromotion looks up a promo code and checks that it may be used now
+// by this customer. Guests are identified by email for per-customer limits;
+// when neither is known (as for quotes) that limit is not checked. With lock
+// set the promotion row is locked so that concurrent checkouts cannot exceed
+// the usage limit.
+func checkoutPromotion(ctx context.Context, db querier, code string, customerID *uuid.UUID, email string, lock bool) (*pricing.Promotion, *fiber.Error) {
+	query := `SELECT ` + promotionColumns + `,
+		  (p.starts_at IS NULL OR p.starts_at <= CURRENT_TIMESTAMP),
+		  (p.ends_at IS NULL OR p.ends_at > CURRENT_TIMESTAMP)
+		FROM promotions p WHERE p.code = $1`
+	if lock {
+		query += ` FOR UPDATE`
+	}
+
+	var promo models.Promotion
+	var started, notEnded bool
+	row := db.QueryRow(ctx, query, normalizePromoCode(code))
+	err := scanPromotionWith(row, &promo, &started, &notEnded)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fiber.NewError(400, "promo code not found")
+	}
+	if err != nil {
+		return nil, fiber.NewError(500, "failed to fetch promo code")
+	}
+
+	switch {
+	case !promo.IsActive:
+		return nil, fiber.NewError(400, "promo code is not active")
+	case !started:
+		return nil, fiber.NewError(400, "promo code is not active yet")
+	case !notEnded:
+		return nil, fiber.NewError(400, "promo code has expired")
+	case promo.UsageLimit != nil && promo.TimesUsed >= *promo.UsageLimit:
+		return nil, fiber.NewError(400, "promo code usage limit reached")
+	}
+
+	if promo.PerCustomerLimit != nil && (customerID != nil || email != "") {
+		var used int
+		err := db.QueryRow(
+			ctx,
+			`SELECT COUNT(*) FROM order_promotions op JOIN orders o ON o.id = op.order_id
+			 WHERE op.promotion_id = $1 AND o.status NOT IN ('cancelled', 'failed')
+			   AND (o.customer_id = $2 OR ($3 <> '' AND LOWER(o.customer_email) = LOWER($3)))`,
+			promo.ID, customerID, email,
+		).Scan(&used)
+		if err != nil {
+			return nil, fiber.NewError(500, "failed to fetch promo code")
+		}
+		if used >= *promo.PerCustomerLimit {
+			return nil, fiber.NewError(400, "promo code already used")
+		}
+	}
+
+	return &pricing.Promotion{
+		ID:               promo.ID,
+		Code:             promo.Code,
+		Type:             promo.Type,
+		Value:            promo.Value,
+		Scope:            promo.Scope,
+		ProductIDs:       promo.ProductIDs,
+		CategoryIDs:      promo.CategoryIDs,
+		MinSubtotalCents: promo.MinSubtotalCents,
+	}, nil
+}
+
+func insertOrderPromotion(ctx context.Context, db querier, orderID uuid.UUID, applied *pricing.AppliedPromotion) error {
+	_, err := db.Exec(
+		ctx,
+		`INSERT INTO order_promotions (order_id, promotion_id, code, type, discount_cents, shipping_discount_cents)
+		 VALUES ($1, $2, $3, $4, $5, $6)`,
+		orderID, applied.ID, applied.Code, applied.Type, applied.DiscountCents, applied.ShippingDiscountCents,
+	)
+	return err
+}
+
+func loadOrderPromotions(ctx context.Context, db querier, order *models.Order) error {
+	rows, err := db.Query(
+		ctx,
+		`SELECT id, order_id, promotion_id, code, type, discount_cents, shipping_discount_cents, created_at
+		 FROM order_promotions WHERE order_id = $1 ORDER BY created_at`,
+		order.ID,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.OrderPromotion
+		err := rows.Scan(
+			&p.ID, &p.OrderID, &p.PromotionID, &p.Code, &p.Type,
+			&p.DiscountCents, &p.ShippingDiscountCents, &p.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+		order.Promotions = append(order.Promotions, p)
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+)
+
+// sqlArgs collects the arguments of one query and hands out their
+// placeholders, so dynamic SQL never splices in values or numbers
+// placeholders by hand.
+type sqlArgs struct {
+	values []any
+}
+
+// add appends v and returns its placeholder, e.g. "$3".
+func (a *sqlArgs) add(v any) string {
+	a.values = append(a.values, v)
+	return "$" + strconv.Itoa(len(a.values))
+}
+
+// sqlFragment renders a condition or expression, adding the values it
+// needs to args.
+type sqlFragment func(args *sqlArgs) string
+
+// sqlWhere is a list of conditions that must all hold. A condition can be
+// tagged with the facet it filters on, so facet counts can be computed
+// without the shopper's own selection for that facet. Conditions are
+// rendered anew for every query, so each query numbers its own arguments.
+type sqlWhere struct {
+	conditions []taggedCondition
+}
+
+type taggedCondition struct {
+	facet string
+	cond  sqlFragment
+}
+
+func (w *sqlWhere) add(cond sqlFragment) {
+	w.conditions = append(w.conditions, taggedCondition{cond: cond})
+}
+
+func (w *sqlWhere) addFacet(facet string, cond sqlFragment) {
+	w.conditions = append(w.conditions, taggedCondition{facet: facet, cond: cond})
+}
+
+// build renders the WHERE clause, leaving out the facet conditions skip
+// reports true for; skip may be nil.
+func (w *sqlWhere) build(args *sqlArgs, skip func(facet string) bool) string {
+	parts := make([]string, 0, len(w.conditions))
+	for _, c := range w.conditions {
+		if c.facet != "" && skip != nil && skip(c.facet) {
+			continue
+		}
+		parts = append(parts, "("+c.cond(args)+")")
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(parts, " AND ")
+}
+
+// skipFacet skips the conditions of one facet.
+func skipFacet(facet string) func(string) bool {
+	return func(f string) bool { return f == facet }
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import "strings"
+
+// countryRegions lists the ISO 3166-2 subdivision codes, without the
+// country prefix, of the countries whose addresses need a region. Regional
+// tax rates are matched on these codes, so addresses in these countries are
+// normalized to them.
+var countryRegions = map[string]map[string]string{
+	"US": {
+		"AL": "Alabama", "AK": "Alaska", "AZ": "Arizona", "AR": "Arkansas", "CA": "California",
+		"CO": "Colorado", "CT": "Connecticut", "DE": "Delaware", "DC": "District of Columbia",
+		"FL": "Florida", "GA": "Georgia", "HI": "Hawaii", "ID": "Idaho", "IL": "Illinois",
+		"IN": "Indiana", "IA": "Iowa", "KS": "Kansas", "KY": "Kentucky", "LA": "Louisiana",
+		"ME": "Maine", "MD": "Maryland", "MA": "Massachusetts", "MI": "Michigan", "MN": "Minnesota",
+		"MS": "Mississippi", "MO": "Missouri", "MT": "Montana", "NE": "Nebraska", "NV": "Nevada",
+		"NH": "New Hampshire", "NJ": "New Jersey", "NM": "New Mexico", "NY": "New York",
+		"NC": "North Carolina", "ND": "North Dakota", "OH": "Ohio", "OK": "Oklahoma", "OR": "Oregon",
+		"PA": "Pennsylvania", "RI": "Rhode Island", "SC": "South Carolina", "SD": "South Dakota",
+		"TN": "Tennessee", "TX": "Texas", "UT": "Utah", "VT": "Vermont", "VA": "Virginia",
+		"WA": "Washington", "WV": "West Virginia", "WI": "Wisconsin", "WY": "Wyoming",
+		"AS": "American Samoa", "GU": "Guam", "MP": "Northern Mariana Islands", "PR": "Puerto Rico",
+		"VI": "U.S. Virgin Islands", "UM": "U.S. Minor Outlying Islands",
+		"AA": "Armed Forces Americas", "AE": "Armed Forces Europe", "AP": "Armed Forces Pacific",
+	},
+	"CA": {
+		"AB": "Alberta", "BC": "British Columbia", "MB": "Manitoba", "NB": "New Brunswick",
+		"NL": "Newfoundland and Labrador", "NS": "Nova Scotia", "NT": "Northwest Territories",
+		"NU": "Nunavut", "ON": "Ontario", "PE": "Prince Edward Island", "QC": "Quebec",
+		"SK": "Saskatchewan", "YT": "Yukon",
+	},
+	"AU": {
+		"ACT": "Australian Capital Territory", "NSW": "New South Wales", "NT": "Northern Territory",
+		"QLD": "Queensland", "SA": "South Australia", "TAS": "Tasmania", "VIC": "Victoria",
+		"WA": "Western Australia",
+	},
+}
+
+// normalizeRegion returns the subdivision code of region, given as a code,
+// a full code such as "US-CA" or a name. ok is false when the country's
+// regions are known and region is none of them; regions of other countries
+// are returned unchanged.
+func normalizeRegion(country, region string) (string, bool) {
+	regions, known := countryRegions[country]
+	if !known || region == "" {
+		return region, true
+	}
+
+	code := strings.TrimPrefix(strings.ToUpper(region), country+"-")
+	if _, ok := regions[code]; ok {
+		return code, true
+	}
+	for code, name := range regions {
+		if strings.EqualFold(name, region) {
+			return code, true
+		}
+	}
+	return "", false
+}
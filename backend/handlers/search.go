@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"regexp"
+	"strings"
+)
+
+// searchQuerySQL parses search terms given as the parameter param. The
+// websearch syntax accepts quotes, "or" and "-" and never fails on
+// malformed input.
+func searchQuerySQL(param string) string {
+	return `websearch_to_tsquery('english', ` + param + `)`
+}
+
+// searchMatchSQL matches products whose name or description contains the
+// terms, or whose name is close to them, which tolerates typos.
+func searchMatchSQL(param string) string {
+	return `(search_vector @@ ` + searchQuerySQL(param) + ` OR ` + param + ` <% name)`
+}
+
+// searchRankSQL orders matches by relevance: full-text rank, where name
+// matches outweigh description matches, plus trigram similarity to the name.
+func searchRankSQL(param string) string {
+	return `ts_rank(search_vector, ` + searchQuerySQL(param) + `) + word_similarity(` + param + `, name)`
+}
+
+// htmlEscapeSQL HTML-escapes a text expression. Highlights are rendered as
+// HTML by clients, so product text is escaped before <mark> tags are added.
+func htmlEscapeSQL(expr string) string {
+	return `replace(replace(replace(replace(replace(` + expr + `, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;'), '''', '&#39;')`
+}
+
+// searchHighlightSQL selects the name and a snippet of the description,
+// HTML-escaped, with the matched terms wrapped in <mark>.
+func searchHighlightSQL(param string) string {
+	return `ts_headline('english', ` + htmlEscapeSQL(`name`) + `, ` + searchQuerySQL(param) + `, 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true'),
+	ts_headline('english', ` + htmlEscapeSQL(`COALESCE(description, '')`) + `, ` + searchQuerySQL(param) + `,
+	  'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=25, MinWords=8, FragmentDelimiter=" … "')`
+}
+
+var nonWordPattern = regexp.MustCompile(`[^\pL\pN]+`)
+
+// prefixTSQuery turns what a shopper has typed so far into a tsquery text
+// matching every word as a prefix, e.g. "red sh" becomes "red:* & sh:*".
+// It returns "" when nothing searchable is left.
+func prefixTSQuery(q string) string {
+	words := nonWordPattern.Split(strings.ToLower(q), -1)
+	terms := make([]string, 0, len(words))
+	for _, w := range words {
+		if w != "" {
+			terms = append(terms, w+":*")
+		}
+	}
+	return strings.Join(terms, " & ")
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/Biz0n58/Zaria/backend/currency"
+	"github.com/Biz0n58/Zaria/backend/models"
+	"github.com/Biz0n58/Zaria/backend/pricing"
+	"github.com/Biz0n58/Zaria/backend/shipping"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+)
+
+const shippingMethodColumns = `id, code, name, provider, config, free_over_cents, is_active, position, created_at, updated_at`
+
+func scanShippingMethod(row pgx.Row, m *models.ShippingMethod) error {
+	return row.Scan(
+		&m.ID, &m.Code, &m.Name, &m.Provider, &m.Config, &m.FreeOverCents,
+		&m.IsActive, &m.Position, &m.CreatedAt, &m.UpdatedAt,
+	)
+}
+
+// activeShippingMethods returns the methods offered at checkout. A method
+// whose stored config no longer parses is skipped rather than failing every
+// checkout.
+func activeShippingMethods(ctx context.Context, db querier) ([]shipping.Method, error) {
+	rows, err := db.Query(
+		ctx,
+		`SELECT `+shippingMethodColumns+` FROM shipping_methods WHERE is_active = true ORDER BY position, name`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	methods := []shipping.Method{}
+	for rows.Next() {
+		var m models.ShippingMethod
+		if err := scanShippingMethod(rows, &m); err != nil {
+			return nil, err
+		}
+		provider, err := shipping.NewProvider(m.Provider, m.Config)
+		if err != nil {
+			log.Printf("shipping: skipping method %s: %v", m.Code, err)
+			continue
+		}
+		methods = append(methods, shipping.Method{
+			Code:          m.Code,
+			Name:          m.Name,
+			Provider:      provider,
+			FreeOverCents: m.FreeOverCents,
+		})
+	}
+	return methods, rows.Err()
+}
+
+// checkoutShipping returns the shipping options for lines, priced in cur,
+// sent to country and the one chosen by code, or the cheapest when code is
+// empty. The choice is nil only when required is false and nothing can
+// ship yet, e.g. a quote for a zone-priced method without a country.
+//
+// Shipping rates are configured in the base currency, so the subtotal is
+// converted to it for free-shipping thresholds and the rates back to cur.
+func checkoutShipping(ctx context.Context, db querier, lines []pricing.Line, rates currency.Rates, cur, country, code string, required bool) (*shipping.Option, []shipping.Option, *fiber.Error) {
+	methods, err := activeShippingMethods(ctx, db)
+	if err != nil {
+		return nil, nil, fiber.NewError(500, "failed to fetch shipping methods")
+	}
+
+	parcel := pricing.Parcel(lines, country)
+	var ok bool
+	if parcel.SubtotalCents, ok = rates.Convert(parcel.SubtotalCents, cur, rates.Base); !ok {
+		return nil, nil, fiber.NewError(400, "unsupported currency "+strings.ToUpper(cur))
+	}
+
+	options := shipping.Options(methods, parcel)
+	for i := range options {
+		if options[i].AmountCents, ok = rates.Convert(options[i].AmountCents, rates.Base, cur); !ok {
+			return nil, nil, fiber.NewError(400, "unsupported currency "+strings.ToUpper(cur))
+		}
+	}
+
+	if code != "" {
+		for i := range options {
+			if options[i].Code == code {
+				return &options[i], options, nil
+			}
+		}
+		return nil, options, fiber.NewError(400, "shipping_method is not available for this order")
+	}
+
+	if len(options) == 0 {
+		if required {
+			return nil, options, fiber.NewError(400, "no shipping method is available for this order")
+		}
+		return nil, options, nil
+	}
+	return &options[0], options, nil
+}
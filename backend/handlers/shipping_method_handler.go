@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/Biz0n58/Zaria/backend/middleware"
+	"github.com/Biz0n58/Zaria/backend/models"
+	"github.com/Biz0n58/Zaria/backend/shipping"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type ShippingMethodHandler struct {
+	DB *pgxpool.Pool
+}
+
+func NewShippingMethodHandler(db *pgxpool.Pool) *ShippingMethodHandler {
+	return &ShippingMethodHandler{DB: db}
+}
+
+var shippingMethodCodePattern = regexp.MustCompile(`^[a-z0-9_-]{2,50}$`)
+
+type ShippingMethodRequest struct {
+	Code          string          `json:"code"`
+	Name          string          `json:"name"`
+	Provider      string          `json:"provider"`
+	Config        json.RawMessage `json:"config"`
+	FreeOverCents *int            `json:"free_over_cents"`
+	IsActive      bool            `json:"is_active"`
+	Position      int             `json:"position"`
+}
+
+type ShippingMethodsResponse struct {
+	ShippingMethods []models.ShippingMethod `json:"shipping_methods"`
+}
+
+func (h *ShippingMethodHandler) ListShippingMethods(c *fiber.Ctx) error {
+	rows, err := h.DB.Query(
+		c.Context(),
+		`SELECT `+shippingMethodColumns+` FROM shipping_methods ORDER BY position, name`,
+	)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch shipping methods"})
+	}
+	defer rows.Close()
+
+	methods := []models.ShippingMethod{}
+	for rows.Next() {
+		var m models.ShippingMethod
+		if err := scanShippingMethod(rows, &m); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to scan shipping method"})
+		}
+		methods = append(methods, m)
+	}
+
+	return c.JSON(ShippingMethodsResponse{ShippingMethods: methods})
+}
+
+func (h *ShippingMethodHandler) GetShippingMethod(c *fiber.Ctx) error {
+	methodUUID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid shipping method id"})
+	}
+
+	method, err := loadShippingMethod(c.Context(), h.DB, methodUUID, false)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "shipping method not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch shipping method"})
+	}
+
+	return c.JSON(method)
+}
+
+func (h *ShippingMethodHandler) CreateShippingMethod(c *fiber.Ctx) error {
+	var req ShippingMethodRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+	if msg := validateShippingMethodRequest(&req); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	var method models.ShippingMethod
+	err := scanShippingMethod(h.DB.QueryRow(
+		c.Context(),
+		`INSERT INTO shipping_methods (code, name, provider, config, free_over_cents, is_active, position)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 RETURNING `+shippingMethodColumns,
+		req.Code, req.Name, req.Provider, req.Config, req.FreeOverCents, req.IsActive, req.Position,
+	), &method)
+	if err != nil {
+		return shippingMethodWriteError(c, err, "failed to create shipping method")
+	}
+
+	middleware.SetAudit(c, "", "shipping_method", method.ID.String(), nil, method)
+
+	return c.Status(201).JSON(method)
+}
+
+func (h *ShippingMethodHandler) UpdateShippingMethod(c *fiber.Ctx) error {
+	methodUUID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid shipping method id"})
+	}
+
+	var req ShippingMethodRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+	if msg := validateShippingMethodRequest(&req); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+	}
+	defer tx.Rollback(c.Context())
+
+	before, err := loadShippingMethod(c.Context(), tx, methodUUID, true)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "shipping method not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch shipping method"})
+	}
+
+	var method models.ShippingMethod
+	err = scanShippingMethod(tx.QueryRow(
+		c.Context(),
+		`UPDATE shipping_methods SET code = $1, name = $2, provider = $3, config = $4, free_over_cents = $5,
+		   is_active = $6, position = $7, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $8
+		 RETURNING `+shippingMethodColumns,
+		req.Code, req.Name, req.Provider, req.Config, req.FreeOverCents, req.IsActive, req.Position, methodUUID,
+	), &method)
+	if err != nil {
+		return shippingMethodWriteError(c, err, "failed to update shipping method")
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+	}
+
+	middleware.SetAudit(c, "", "shipping_method", method.ID.String(), before, method)
+
+	return c.JSON(method)
+}
+
+// DeleteShippingMethod removes the method. Orders keep the code and name
+// they were placed with.
+func (h *ShippingMethodHandler) DeleteShippingMethod(c *fiber.Ctx) error {
+	methodUUID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid shipping method id"})
+	}
+
+	var method models.ShippingMethod
+	err = scanShippingMethod(h.DB.QueryRow(
+		c.Context(),
+		`DELETE FROM shipping_methods WHERE id = $1 RETURNING `+shippingMethodColumns,
+		methodUUID,
+	), &method)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "shipping method not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "failed to delete shipping method"})
+	}
+
+	middleware.SetAudit(c, "", "shipping_method", method.ID.String(), method, nil)
+
+	return c.JSON(fiber.Map{"message": "shipping method deleted"})
+}
+
+func loadShippingMethod(ctx context.Context, db querier, methodID uuid.UUID, lock bool) (models.ShippingMethod, error) {
+	query := `SELECT ` + shippingMethodColumns + ` FROM shipping_methods WHERE id = $1`
+	if lock {
+		query += ` FOR UPDATE`
+	}
+
+	var m models.ShippingMethod
+	err := scanShippingMethod(db.QueryRow(ctx, query, methodID), &m)
+	return m, err
+}
+
+// validateShippingMethodRequest normalizes req, including its config, and
+// returns a message describing the first problem, or "" if it is valid.
+func validateShippingMethodRequest(req *ShippingMethodRequest) string {
+	req.Code = strings.ToLower(strings.TrimSpace(req.Code))
+	if !shippingMethodCodePattern.MatchString(req.Code) {
+		return "code must be 2-50 lowercase letters, digits, '-' or '_'"
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return "name is required"
+	}
+	if req.FreeOverCents != nil && *req.FreeOverCents < 0 {
+		return "free_over_cents must be non-negative"
+	}
+
+	provider, err := shipping.NewProvider(req.Provider, req.Config)
+	if err != nil {
+		return err.Error()
+	}
+	config, err := json.Marshal(provider)
+	if err != nil {
+		return "invalid config"
+	}
+	req.Config = config
+
+	return ""
+}
+
+func shippingMethodWriteError(c *fiber.Ctx, err error, fallback string) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return c.Status(409).JSON(fiber.Map{"error": "a shipping method with this code already exists"})
+	}
+	return c.Status(500).JSON(fiber.Map{"error": fallback})
+}
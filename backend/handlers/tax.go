@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Biz0n58/Zaria/backend/models"
+	"github.com/Biz0n58/Zaria/backend/tax"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const taxRateColumns = `id, name, country, region, tax_class, rate_bps, inclusive, applies_to_shipping, created_at, updated_at`
+
+func scanTaxRate(row pgx.Row, r *models.TaxRate) error {
+	return row.Scan(
+		&r.ID, &r.Name, &r.Country, &r.Region, &r.TaxClass, &r.RateBPS,
+		&r.Inclusive, &r.AppliesToShipping, &r.CreatedAt, &r.UpdatedAt,
+	)
+}
+
+// taxCalculator returns a calculator over the rates that can apply to a
+// destination in country and region.
+func taxCalculator(ctx context.Context, db querier, country, region string) (tax.TaxCalculator, error) {
+	rows, err := db.Query(
+		ctx,
+		`SELECT `+taxRateColumns+` FROM tax_rates
+		 WHERE country = $1 AND (region = '' OR region = $2)
+		 ORDER BY region, name`,
+		strings.ToUpper(country), strings.ToUpper(region),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	table := tax.Table{}
+	for rows.Next() {
+		var r models.TaxRate
+		if err := scanTaxRate(rows, &r); err != nil {
+			return nil, err
+		}
+		table.Rates = append(table.Rates, tax.Rate{
+			Name:        r.Name,
+			Country:     r.Country,
+			Region:      r.Region,
+			TaxClass:    r.TaxClass,
+			BasisPoints: r.RateBPS,
+			Inclusive:   r.Inclusive,
+			Shipping:    r.AppliesToShipping,
+		})
+	}
+	return table, rows.Err()
+}
+
+func insertOrderTaxLines(ctx context.Context, db querier, orderID uuid.UUID, lines []tax.Line) error {
+	for _, l := range lines {
+		_, err := db.Exec(
+			ctx,
+			`INSERT INTO order_tax_lines (order_id, name, country, region, rate_bps, inclusive, taxable_cents, amount_cents)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			orderID, l.Name, l.Country, l.Region, l.BasisPoints, l.Inclusive, l.TaxableCents, l.AmountCents,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadOrderTaxLines(ctx context.Context, db querier, order *models.Order) error {
+	rows, err := db.Query(
+		ctx,
+		`SELECT id, order_id, name, country, region, rate_bps, inclusive, taxable_cents, amount_cents, created_at
+		 FROM order_tax_lines WHERE order_id = $1 ORDER BY created_at, name`,
+		order.ID,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var l models.OrderTaxLine
+		err := rows.Scan(
+			&l.ID, &l.OrderID, &l.Name, &l.Country, &l.Region, &l.RateBPS,
+			&l.Inclusive, &l.TaxableCents, &l.AmountCents, &l.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+		order.TaxLines = append(order.TaxLines, l)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/Biz0n58/Zaria/backend/middleware"
+	"github.com/Biz0n58/Zaria/backend/models"
+	"github.com/Biz0n58/Zaria/backend/tax"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type TaxRateHandler struct {
+	DB *pgxpool.Pool
+}
+
+func NewTaxRateHandler(db *pgxpool.Pool) *TaxRateHandler {
+	return &TaxRateHandler{DB: db}
+}
+
+type TaxRateRequest struct {
+	Name              string `json:"name"`
+	Country           string `json:"country"`
+	Region            string `json:"region"`
+	TaxClass          string `json:"tax_class"`
+	RateBPS           int    `json:"rate_bps"`
+	Inclusive         bool   `json:"inclusive"`
+	AppliesToShipping bool   `json:"applies_to_shipping"`
+}
+
+type TaxRatesResponse struct {
+	TaxRates []models.TaxRate `json:"tax_rates"`
+}
+
+// ListTaxRates returns every rate, optionally only those of ?country=.
+func (h *TaxRateHandler) ListTaxRates(c *fiber.Ctx) error {
+	query := `SELECT ` + taxRateColumns + ` FROM tax_rates`
+	args := []interface{}{}
+	if country := strings.ToUpper(strings.TrimSpace(c.Query("country"))); country != "" {
+		query += ` WHERE country = $1`
+		args = append(args, country)
+	}
+	query += ` ORDER BY country, region, tax_class, name`
+
+	rows, err := h.DB.Query(c.Context(), query, args...)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch tax rates"})
+	}
+	defer rows.Close()
+
+	rates := []models.TaxRate{}
+	for rows.Next() {
+		var r models.TaxRate
+		if err := scanTaxRate(rows, &r); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to scan tax rate"})
+		}
+		rates = append(rates, r)
+	}
+
+	return c.JSON(TaxRatesResponse{TaxRates: rates})
+}
+
+func (h *TaxRateHandler) GetTaxRate(c *fiber.Ctx) error {
+	rateUUID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid tax rate id"})
+	}
+
+	rate, err := loadTaxRate(c.Context(), h.DB, rateUUID, false)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "tax rate not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch tax rate"})
+	}
+
+	return c.JSON(rate)
+}
+
+func (h *TaxRateHandler) CreateTaxRate(c *fiber.Ctx) error {
+	var req TaxRateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+	if msg := validateTaxRateRequest(&req); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	var rate models.TaxRate
+	err := scanTaxRate(h.DB.QueryRow(
+		c.Context(),
+		`INSERT INTO tax_rates (name, country, region, tax_class, rate_bps, inclusive, applies_to_shipping)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 RETURNING `+taxRateColumns,
+		req.Name, req.Country, req.Region, req.TaxClass, req.RateBPS, req.Inclusive, req.AppliesToShipping,
+	), &rate)
+	if err != nil {
+		return taxRateWriteError(c, err, "failed to create tax rate")
+	}
+
+	middleware.SetAudit(c, "", "tax_rate", rate.ID.String(), nil, rate)
+
+	return c.Status(201).JSON(rate)
+}
+
+func (h *TaxRateHandler) UpdateTaxRate(c *fiber.Ctx) error {
+	rateUUID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid tax rate id"})
+	}
+
+	var req TaxRateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+	}
+	if msg := validateTaxRateRequest(&req); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	tx, err := h.DB.Begin(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to start transaction"})
+	}
+	defer tx.Rollback(c.Context())
+
+	before, err := loadTaxRate(c.Context(), tx, rateUUID, true)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "tax rate not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch tax rate"})
+	}
+
+	var rate models.TaxRate
+	err = scanTaxRate(tx.QueryRow(
+		c.Context(),
+		`UPDATE tax_rates SET name = $1, country = $2, region = $3, tax_class = $4, rate_bps = $5,
+		   inclusive = $6, applies_to_shipping = $7, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $8
+		 RETURNING `+taxRateColumns,
+		req.Name, req.Country, req.Region, req.TaxClass, req.RateBPS, req.Inclusive, req.AppliesToShipping, rateUUID,
+	), &rate)
+	if err != nil {
+		return taxRateWriteError(c, err, "failed to update tax rate")
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to commit transaction"})
+	}
+
+	middleware.SetAudit(c, "", "tax_rate", rate.ID.String(), before, rate)
+
+	return c.JSON(rate)
+}
+
+// DeleteTaxRate removes the rate. Orders keep the tax lines they were
+// placed with.
+func (h *TaxRateHandler) DeleteTaxRate(c *fiber.Ctx) error {
+	rateUUID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid tax rate id"})
+	}
+
+	var rate models.TaxRate
+	err = scanTaxRate(h.DB.QueryRow(
+		c.Context(),
+		`DELETE FROM tax_rates WHERE id = $1 RETURNING `+taxRateColumns,
+		rateUUID,
+	), &rate)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "tax rate not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "failed to delete tax rate"})
+	}
+
+	middleware.SetAudit(c, "", "tax_rate", rate.ID.String(), rate, nil)
+
+	return c.JSON(fiber.Map{"message": "tax rate deleted"})
+}
+
+func loadTaxRate(ctx context.Context, db querier, rateID uuid.UUID, lock bool) (models.TaxRate, error) {
+	query := `SELECT ` + taxRateColumns + ` FROM tax_rates WHERE id = $1`
+	if lock {
+		query += ` FOR UPDATE`
+	}
+
+	var r models.TaxRate
+	err := scanTaxRate(db.QueryRow(ctx, query, rateID), &r)
+	return r, err
+}
+
+// validateTaxRateRequest normalizes req and returns a message describing the
+// first problem, or "" if it is valid.
+func validateTaxRateRequest(req *TaxRateRequest) string {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return "name is required"
+	}
+	req.Country = strings.ToUpper(strings.TrimSpace(req.Country))
+	if !countryCodePattern.MatchString(req.Country) {
+		return "country must be a two-letter ISO code"
+	}
+	// Addresses only carry normalized region codes for the countries in
+	// countryRegions, so regional rates elsewhere could never match.
+	req.Region = strings.TrimSpace(req.Region)
+	if req.Region != "" {
+		if _, known := countryRegions[req.Country]; !known {
+			return "regional rates are only supported for US, CA and AU"
+		}
+		region, ok := normalizeRegion(req.Country, req.Region)
+		if !ok {
+			return "region is not a valid region of " + req.Country
+		}
+		req.Region = region
+	}
+
+	req.TaxClass = strings.ToLower(strings.TrimSpace(req.TaxClass))
+	if req.TaxClass == "" {
+		req.TaxClass = tax.DefaultClass
+	}
+	if !taxClassPattern.MatchString(req.TaxClass) {
+		return "tax_class must be 1-50 lowercase letters, digits, '-' or '_'"
+	}
+	if req.RateBPS < 0 || req.RateBPS > 10000 {
+		return "rate_bps must be between 0 and 10000"
+	}
+	if req.AppliesToShipping && req.TaxClass != tax.DefaultClass {
+		return "applies_to_shipping is only supported for the standard tax class"
+	}
+
+	return ""
+}
+
+func taxRateWriteError(c *fiber.Ctx, err error, fallback string) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return c.Status(409).JSON(fiber.Map{"error": "a tax rate with this name already exists for the region and class"})
+	}
+	return c.Status(500).JSON(fiber.Map{"error": fallback})
+}
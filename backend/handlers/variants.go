@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Biz0n58/Zaria/backend/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const productOptionColumns = `id, product_id, name, option_values, position, created_at, updated_at`
+
+func scanProductOption(row pgx.Row, o *models.ProductOption) error {
+	return row.Scan(&o.ID, &o.ProductID, &o.Name, &o.Values, &o.Position, &o.CreatedAt, &o.UpdatedAt)
+}
+
+// variantOptionsSQL selects the option values of the variant v as JSON, in
+// the order of the product's options.
+const variantOptionsSQL = `COALESCE((SELECT json_agg(json_build_object('option', o.name, 'value', vo.value) ORDER BY o.position, o.name)
+	          FROM product_variant_options vo JOIN product_options o ON o.id = vo.option_id
+	          WHERE vo.variant_id = v.id), '[]')`
+
+const productVariantColumns = `v.id, v.product_id, v.sku, v.price_cents, v.stock, v.image_url, v.is_active, v.position,
+	` + variantOptionsSQL + `, v.created_at, v.updated_at`
+
+func scanProductVariant(row pgx.Row, v *models.ProductVariant) error {
+	return row.Scan(
+		&v.ID, &v.ProductID, &v.SKU, &v.PriceCents, &v.Stock, &v.ImageURL, &v.IsActive, &v.Position,
+		&v.Options, &v.CreatedAt, &v.UpdatedAt,
+	)
+}
+
+func listProductOptions(ctx context.Context, db querier, productID uuid.UUID) ([]models.ProductOption, error) {
+	rows, err := db.Query(
+		ctx,
+		`SELECT `+productOptionColumns+` FROM product_options WHERE product_id = $1 ORDER BY position, name`,
+		productID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	options := []models.ProductOption{}
+	for rows.Next() {
+		var o models.ProductOption
+		if err := scanProductOption(rows, &o); err != nil {
+			return nil, err
+		}
+		options = append(options, o)
+	}
+	return options, rows.Err()
+}
+
+func listProductVariants(ctx context.Context, db querier, productID uuid.UUID) ([]models.ProductVariant, error) {
+	rows, err := db.Query(
+		ctx,
+		`SELECT `+productVariantColumns+` FROM product_variants v WHERE v.product_id = $1 ORDER BY v.position, v.sku`,
+		productID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	variants := []models.ProductVariant{}
+	for rows.Next() {
+		var v models.ProductVariant
+		if err := scanProductVariant(rows, &v); err != nil {
+			return nil, err
+		}
+		variants = append(variants, v)
+	}
+	return variants, rows.Err()
+}
+
+// loadProductVariants fills in the options and variants of p.
+func loadProductVariants(ctx context.Context, db querier, p *models.Product) error {
+	var err error
+	if p.Options, err = listProductOptions(ctx, db, p.ID); err != nil {
+		return err
+	}
+	p.Variants, err = listProductVariants(ctx, db, p.ID)
+	return err
+}
+
+// parseVariantID parses the optional variant id of a checkout or cart item.
+func parseVariantID(s string) (*uuid.UUID, *fiber.Error) {
+	if s == "" {
+		return nil, nil
+	}
+	id, err := uuid.Parse(s)
+	if err != nil {
+		return nil, fiber.NewError(400, "invalid variant id")
+	}
+	return &id, nil
+}
+
+// checkVariant checks that variantID, if given, is an active variant of the
+// product, and that a variant is given when the product is sold in
+// variants.
+func checkVariant(ctx context.Context, db querier, productID uuid.UUID, variantID *uuid.UUID) *fiber.Error {
+	if variantID == nil {
+		var hasVariants bool
+		err := db.QueryRow(
+			ctx,
+			`SELECT EXISTS (SELECT 1 FROM product_variants WHERE product_id = $1)`,
+			productID,
+		).Scan(&hasVariants)
+		if err != nil {
+			return fiber.NewError(500, "failed to fetch product")
+		}
+		if hasVariants {
+			return fiber.NewError(400, "variant_id is required for this product")
+		}
+		return nil
+	}
+
+	var active bool
+	err := db.QueryRow(
+		ctx,
+		`SELECT is_active FROM product_variants WHERE id = $1 AND product_id = $2`,
+		*variantID, productID,
+	).Scan(&active)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && !active) {
+		return fiber.NewError(404, "variant not found")
+	}
+	if err != nil {
+		return fiber.NewError(500, "failed to fetch variant")
+	}
+	return nil
+}
+
+// variantOptionsJSON is stored as the variant options of an order item,
+// which are never null.
+func variantOptionsJSON(options []models.VariantOptionValue) []models.VariantOptionValue {
+	if options == nil {
+		return []models.VariantOptionValue{}
+	}
+	return options
+}
@@ -0,0 +1,199 @@
+// Package inventory reserves stock for orders and gives it back when an
+// order is cancelled, fails to pay or is never paid.
+package inventory
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	DefaultReservationTTL = 30 * time.Minute
+	DefaultSweepInterval  = time.Minute
+)
+
+// DB is satisfied by both *pgxpool.Pool and pgx.Tx.
+type DB interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// Item is a quantity of a product or, when VariantID is set, of one of its
+// variants, which have their own stock.
+type Item struct {
+	ProductID uuid.UUID
+	VariantID *uuid.UUID
+	Qty       int
+}
+
+// ReservationTTL is how long an unpaid order holds its stock, set with
+// STOCK_RESERVATION_TTL (e.g. "45m").
+func ReservationTTL() time.Duration {
+	return durationEnv("STOCK_RESERVATION_TTL", DefaultReservationTTL)
+}
+
+// SweepInterval is how often expired reservations are looked for, set with
+// STOCK_SWEEP_INTERVAL.
+func SweepInterval() time.Duration {
+	return durationEnv("STOCK_SWEEP_INTERVAL", DefaultSweepInterval)
+}
+
+func durationEnv(name string, fallback time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Printf("inventory: invalid %s %q, using %s", name, v, fallback)
+		return fallback
+	}
+	return d
+}
+
+// Reserve takes items out of stock for the order. The caller must already
+// hold row locks on the products and variants and have checked that enough
+// is in stock.
+func Reserve(ctx context.Context, db DB, orderID uuid.UUID, items []Item) error {
+	for _, item := range items {
+		var err error
+		if item.VariantID != nil {
+			_, err = db.Exec(
+				ctx,
+				`UPDATE product_variants SET stock = stock - $1 WHERE id = $2`,
+				item.Qty, *item.VariantID,
+			)
+		} else {
+			_, err = db.Exec(
+				ctx,
+				`UPDATE products SET stock = stock - $1 WHERE id = $2`,
+				item.Qty, item.ProductID,
+			)
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(
+			ctx,
+			`INSERT INTO stock_reservations (order_id, product_id, variant_id, qty, expires_at)
+			 VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP + make_interval(secs => $5))`,
+			orderID, item.ProductID, item.VariantID, item.Qty, ReservationTTL().Seconds(),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Commit keeps the order's stock for good once it has been paid.
+func Commit(ctx context.Context, db DB, orderID uuid.UUID) error {
+	_, err := db.Exec(
+		ctx,
+		`UPDATE stock_reservations SET committed_at = CURRENT_TIMESTAMP
+		 WHERE order_id = $1 AND committed_at IS NULL AND released_at IS NULL`,
+		orderID,
+	)
+	return err
+}
+
+// Release returns every reservation of the order that has not been released
+// yet to stock. It is safe to call more than once.
+func Release(ctx context.Context, db DB, orderID uuid.UUID) error {
+	_, err := db.Exec(
+		ctx,
+		`WITH released AS (
+		   UPDATE stock_reservations SET released_at = CURRENT_TIMESTAMP
+		   WHERE order_id = $1 AND released_at IS NULL
+		   RETURNING product_id, variant_id, qty
+		 ), restocked AS (
+		   UPDATE products p SET stock = p.stock + r.qty
+		   FROM (SELECT product_id, SUM(qty) AS qty FROM released WHERE variant_id IS NULL GROUP BY product_id) r
+		   WHERE p.id = r.product_id
+		 )
+		 UPDATE product_variants v SET stock = v.stock + r.qty
+		 FROM (SELECT variant_id, SUM(qty) AS qty FROM released WHERE variant_id IS NOT NULL GROUP BY variant_id) r
+		 WHERE v.id = r.variant_id`,
+		orderID,
+	)
+	return err
+}
+
+// Reclaim takes the released stock of an order out of stock again, for an
+// order that is paid or reopened after it had been cancelled, and reserves
+// it for another ReservationTTL. It reports false, changing nothing, when
+// some of that stock has been sold in the meantime.
+func Reclaim(ctx context.Context, db DB, orderID uuid.UUID) (bool, error) {
+	rows, err := db.Query(
+		ctx,
+		`SELECT product_id, variant_id, SUM(qty) FROM stock_reservations
+		 WHERE order_id = $1 AND released_at IS NOT NULL
+		 GROUP BY product_id, variant_id
+		 ORDER BY product_id, variant_id NULLS FIRST`,
+		orderID,
+	)
+	if err != nil {
+		return false, err
+	}
+	var items []Item
+	for rows.Next() {
+		var item Item
+		if err := rows.Scan(&item.ProductID, &item.VariantID, &item.Qty); err != nil {
+			rows.Close()
+			return false, err
+		}
+		items = append(items, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+
+	// Products, then their variants, are locked in the order checkout locks
+	// them in.
+	for _, item := range items {
+		var stock int
+		err = db.QueryRow(ctx, `SELECT stock FROM products WHERE id = $1 FOR UPDATE`, item.ProductID).Scan(&stock)
+		if err == nil && item.VariantID != nil {
+			err = db.QueryRow(ctx, `SELECT stock FROM product_variants WHERE id = $1 FOR UPDATE`, *item.VariantID).Scan(&stock)
+		}
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if stock < item.Qty {
+			return false, nil
+		}
+	}
+
+	for _, item := range items {
+		if item.VariantID != nil {
+			_, err = db.Exec(ctx, `UPDATE product_variants SET stock = stock - $1 WHERE id = $2`, item.Qty, *item.VariantID)
+		} else {
+			_, err = db.Exec(ctx, `UPDATE products SET stock = stock - $1 WHERE id = $2`, item.Qty, item.ProductID)
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+
+	_, err = db.Exec(
+		ctx,
+		`UPDATE stock_reservations
+		 SET released_at = NULL, expires_at = CURRENT_TIMESTAMP + make_interval(secs => $2)
+		 WHERE order_id = $1 AND released_at IS NOT NULL`,
+		orderID, ReservationTTL().Seconds(),
+	)
+	return err == nil, err
+}
@@ -0,0 +1,101 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RunSweeper cancels stale unpaid orders every interval until ctx is done.
+// Each backend instance may run it; orders are claimed with SKIP LOCKED.
+func RunSweeper(ctx context.Context, db *pgxpool.Pool, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := SweepExpired(ctx, db)
+			if err != nil {
+				log.Println("inventory: sweep failed:", err)
+			}
+			if n > 0 {
+				log.Printf("inventory: cancelled %d unpaid orders and released their stock", n)
+			}
+		}
+	}
+}
+
+// SweepExpired cancels pending orders whose reservations have expired and
+// puts their stock back. An order whose customer has started paying gets one
+// more reservation period before it is cancelled. It returns the number of
+// orders cancelled.
+func SweepExpired(ctx context.Context, db *pgxpool.Pool) (int, error) {
+	cancelled := 0
+	for {
+		ok, err := sweepOne(ctx, db)
+		if err != nil {
+			return cancelled, err
+		}
+		if !ok {
+			return cancelled, nil
+		}
+		cancelled++
+	}
+}
+
+func sweepOne(ctx context.Context, db *pgxpool.Pool) (bool, error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var orderID uuid.UUID
+	err = tx.QueryRow(
+		ctx,
+		`SELECT o.id FROM orders o
+		 WHERE o.status = 'pending'
+		   AND EXISTS (
+		     SELECT 1 FROM stock_reservations r
+		     WHERE r.order_id = o.id AND r.committed_at IS NULL AND r.released_at IS NULL
+		       AND r.expires_at < CURRENT_TIMESTAMP
+		   )
+		   AND NOT EXISTS (
+		     SELECT 1 FROM payments p
+		     WHERE p.order_id = o.id AND p.status = 'pending'
+		       AND p.updated_at > CURRENT_TIMESTAMP - make_interval(secs => $1)
+		   )
+		 LIMIT 1
+		 FOR UPDATE OF o SKIP LOCKED`,
+		ReservationTTL().Seconds(),
+	).Scan(&orderID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		`UPDATE orders SET status = 'cancelled', updated_at = CURRENT_TIMESTAMP WHERE id = $1`,
+		orderID,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	if err := Release(ctx, tx, orderID); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit(ctx)
+}
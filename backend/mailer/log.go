@@ -0,0 +1,44 @@
+package mailer
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LogMailer writes each message to a .eml file in Dir, or to the server log
+// when Dir is empty, instead of delivering it.
+type LogMailer struct {
+	Dir  string
+	From string
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	raw := formatMessage(m.From, msg)
+
+	if m.Dir == "" {
+		log.Printf("mailer: message to %s\n%s", msg.To, raw)
+		return nil
+	}
+
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+
+	name := strconv.FormatInt(time.Now().UnixNano(), 10) + "-" + sanitizeFilename(msg.To) + ".eml"
+	return os.WriteFile(filepath.Join(m.Dir, name), raw, 0o600)
+}
+
+func sanitizeFilename(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '@' || r == '.' || r == '-' || r == '_' ||
+			(r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,43 @@
+// Package mailer sends transactional emails such as password resets.
+package mailer
+
+import (
+	"context"
+	"log"
+	"os"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers a plain-text message.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewFromEnv picks the implementation from MAIL_DRIVER: "smtp" sends through
+// SMTP_HOST, anything else writes messages to MAIL_DIR or, when that is not
+// set, to the server log. The log driver is meant for local development.
+func NewFromEnv() Mailer {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "Zaria <no-reply@zaria.local>"
+	}
+
+	switch os.Getenv("MAIL_DRIVER") {
+	case "smtp":
+		return &SMTPMailer{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}
+	default:
+		log.Println("mailer: using log driver, emails are not delivered")
+		return &LogMailer{Dir: os.Getenv("MAIL_DIR"), From: from}
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 
@@ -11,6 +12,8 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/logger"
 
 	"github.com/Biz0n58/Zaria/backend/config"
+	"github.com/Biz0n58/Zaria/backend/inventory"
+	"github.com/Biz0n58/Zaria/backend/mailer"
 	"github.com/Biz0n58/Zaria/backend/routes"
 )
 
@@ -21,7 +24,7 @@ func main() {
 
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     "http://localhost:3000",
-		AllowHeaders:     "Origin, Content-Type, Accept, Authorization",
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, X-Cart-Token, Idempotency-Key",
 		AllowCredentials: true,
 	}))
 
@@ -39,7 +42,11 @@ func main() {
 		})
 	})
 
-	routes.Register(app, db)
+	routes.Register(app, db, mailer.NewFromEnv())
+
+	sweepCtx, stopSweeper := context.WithCancel(context.Background())
+	defer stopSweeper()
+	go inventory.RunSweeper(sweepCtx, db, inventory.SweepInterval())
 
 	port := os.Getenv("APP_PORT")
 	if port == "" {
@@ -0,0 +1,168 @@
+package middleware
+
+import (
+	"encoding/json"
+	"log"
+	"reflect"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const auditContextKey = "audit"
+
+type auditDetails struct {
+	Action     string
+	EntityType string
+	EntityID   string
+	Before     any
+	After      any
+}
+
+// SetAudit lets a handler describe the change it made. Empty strings keep
+// the defaults derived from the request; before or after may be nil for
+// creations and deletions.
+func SetAudit(c *fiber.Ctx, action, entityType, entityID string, before, after any) {
+	c.Locals(auditContextKey, &auditDetails{
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Before:     before,
+		After:      after,
+	})
+}
+
+// Audit records every mutating request in audit_log once the handler has
+// run. It must be placed after Protected so the admin is known.
+func Audit(db *pgxpool.Pool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead || c.Method() == fiber.MethodOptions {
+			return c.Next()
+		}
+
+		handlerErr := c.Next()
+
+		details, _ := c.Locals(auditContextKey).(*auditDetails)
+		if details == nil {
+			details = &auditDetails{}
+		}
+		if details.Action == "" {
+			details.Action = defaultAuditAction(c.Method())
+		}
+		if details.EntityType == "" {
+			details.EntityType = defaultAuditEntity(c.Path())
+		}
+		if details.EntityID == "" {
+			details.EntityID = c.Params("id")
+		}
+
+		var adminID, apiKeyID *uuid.UUID
+		if claims := AdminFromContext(c); claims != nil {
+			if id, err := uuid.Parse(claims.AdminID); err == nil {
+				adminID = &id
+			}
+			if id, err := uuid.Parse(claims.APIKeyID); err == nil {
+				apiKeyID = &id
+			}
+		}
+
+		statusCode := c.Response().StatusCode()
+		if handlerErr != nil {
+			if fe, ok := handlerErr.(*fiber.Error); ok {
+				statusCode = fe.Code
+			} else {
+				statusCode = fiber.StatusInternalServerError
+			}
+		}
+
+		before := auditJSON(details.Before)
+		after := auditJSON(details.After)
+
+		_, err := db.Exec(
+			c.Context(),
+			`INSERT INTO audit_log (admin_id, api_key_id, action, entity_type, entity_id, method, path, status_code, before, after, changes, ip_address, user_agent)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+			adminID, apiKeyID, details.Action, details.EntityType, details.EntityID, c.Method(), c.Path(), statusCode,
+			before, after, auditDiff(before, after), c.IP(), c.Get(fiber.HeaderUserAgent),
+		)
+		if err != nil {
+			log.Println("audit: failed to record entry:", err)
+		}
+
+		return handlerErr
+	}
+}
+
+func defaultAuditAction(method string) string {
+	switch method {
+	case fiber.MethodPost:
+		return "create"
+	case fiber.MethodPut, fiber.MethodPatch:
+		return "update"
+	case fiber.MethodDelete:
+		return "delete"
+	default:
+		return strings.ToLower(method)
+	}
+}
+
+// defaultAuditEntity takes the first path segment below /api/admin, e.g.
+// "products" for /api/admin/products/:id.
+func defaultAuditEntity(path string) string {
+	rest := strings.TrimPrefix(path, "/api/admin/")
+	if i := strings.Index(rest, "/"); i >= 0 {
+		rest = rest[:i]
+	}
+	return rest
+}
+
+func auditJSON(v any) []byte {
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Pointer && reflect.ValueOf(v).IsNil()) {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// auditDiff returns the top-level fields whose values differ between before
+// and after as {"field": {"from": ..., "to": ...}}.
+func auditDiff(before, after []byte) []byte {
+	if before == nil && after == nil {
+		return nil
+	}
+
+	var b, a map[string]any
+	if before != nil {
+		if err := json.Unmarshal(before, &b); err != nil {
+			return nil
+		}
+	}
+	if after != nil {
+		if err := json.Unmarshal(after, &a); err != nil {
+			return nil
+		}
+	}
+
+	changes := map[string]map[string]any{}
+	for k, bv := range b {
+		if av, ok := a[k]; !ok || !reflect.DeepEqual(av, bv) {
+			changes[k] = map[string]any{"from": bv, "to": a[k]}
+		}
+	}
+	for k, av := range a {
+		if _, ok := b[k]; !ok {
+			changes[k] = map[string]any{"from": nil, "to": av}
+		}
+	}
+
+	out, err := json.Marshal(changes)
+	if err != nil {
+		return nil
+	}
+	return out
+}
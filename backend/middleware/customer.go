@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Biz0n58/Zaria/backend/models"
+)
+
+const (
+	CustomerTokenTTL = 30 * 24 * time.Hour
+
+	// customerAudience keeps customer tokens from being accepted by
+	// Protected and admin tokens from being accepted here.
+	customerAudience   = "customer"
+	customerContextKey = "customer"
+)
+
+type CustomerClaims struct {
+	CustomerID string `json:"customer_id"`
+	Email      string `json:"email"`
+	// TokenVersion must match customers.token_version for the token to be
+	// accepted.
+	TokenVersion int `json:"token_version"`
+	jwt.RegisteredClaims
+}
+
+func GenerateCustomerToken(customer models.Customer) (string, time.Time, error) {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		return "", time.Time{}, ErrMissingSecret
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(CustomerTokenTTL)
+
+	claims := CustomerClaims{
+		CustomerID:   customer.ID.String(),
+		Email:        customer.Email,
+		TokenVersion: customer.TokenVersion,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    TokenIssuer,
+			Subject:   customer.ID.String(),
+			Audience:  jwt.ClaimStrings{customerAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return token, expiresAt, nil
+}
+
+// CustomerFromContext returns the customer authenticated by CustomerProtected
+// or OptionalCustomer, or nil for guests.
+func CustomerFromContext(c *fiber.Ctx) *CustomerClaims {
+	claims, _ := c.Locals(customerContextKey).(*CustomerClaims)
+	return claims
+}
+
+// CustomerProtected requires a valid customer bearer token.
+func CustomerProtected(db *pgxpool.Pool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Get(fiber.HeaderAuthorization) == "" {
+			return unauthorized(c)
+		}
+		return verifyCustomerToken(c, db)
+	}
+}
+
+// OptionalCustomer authenticates the customer when a bearer token is sent
+// and lets guests through otherwise. A token that is present but invalid is
+// rejected rather than silently treated as a guest.
+func OptionalCustomer(db *pgxpool.Pool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Get(fiber.HeaderAuthorization) == "" {
+			return c.Next()
+		}
+		return verifyCustomerToken(c, db)
+	}
+}
+
+// verifyCustomerToken checks the bearer token and that it was issued since
+// the customer's last password reset.
+func verifyCustomerToken(c *fiber.Ctx, db *pgxpool.Pool) error {
+	auth := c.Get(fiber.HeaderAuthorization)
+
+	const prefix = "Bearer "
+	if len(auth) <= len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return unauthorized(c)
+	}
+
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "server configuration error",
+		})
+	}
+
+	var claims CustomerClaims
+	_, err := jwt.ParseWithClaims(
+		strings.TrimSpace(auth[len(prefix):]),
+		&claims,
+		func(t *jwt.Token) (interface{}, error) { return []byte(secret), nil },
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(TokenIssuer),
+		jwt.WithAudience(customerAudience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || claims.CustomerID == "" {
+		return unauthorized(c)
+	}
+
+	var tokenVersion int
+	err = db.QueryRow(c.Context(), `SELECT token_version FROM customers WHERE id = $1`, claims.CustomerID).Scan(&tokenVersion)
+	if err != nil || tokenVersion != claims.TokenVersion {
+		return unauthorized(c)
+	}
+
+	c.Locals(customerContextKey, &claims)
+	return c.Next()
+}
@@ -0,0 +1,225 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	// IdempotencyKeyTTL is how long a stored response is replayed.
+	IdempotencyKeyTTL = 24 * time.Hour
+	// A request still marked in progress after this long is assumed to
+	// have died and may be retried.
+	idempotencyLockTimeout = 5 * time.Minute
+
+	maxIdempotencyKeyLength = 255
+
+	idempotencyContextKey = "idempotency"
+)
+
+// idempotencyClaim is the key held by the current request.
+type idempotencyClaim struct {
+	scope string
+	key   string
+	// stored is set once the handler has stored its response itself.
+	stored bool
+}
+
+// IdempotencyKeyFromContext returns the key of the current request, or "" if
+// the client did not send one.
+func IdempotencyKeyFromContext(c *fiber.Ctx) string {
+	return c.Get(IdempotencyKeyHeader)
+}
+
+// Idempotent makes POST handlers safe to retry. The first request with a
+// given Idempotency-Key runs normally and its response is stored; repeats of
+// the same request get the stored response back, while reusing the key for a
+// different request is rejected with 422. Responses with a 5xx status are not
+// stored so that the client can retry them. Requests without the header are
+// passed through unchanged.
+//
+// Handlers that commit changes should store their response in the same
+// transaction with StoreIdempotentResponse; otherwise it is stored once the
+// handler returns, and a key whose response could not be stored is marked
+// completed so that it can never run twice.
+//
+// The scope keeps keys of different endpoints apart. Place it after any
+// authentication middleware so the caller is part of the request hash.
+func Idempotent(db *pgxpool.Pool, scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Get(IdempotencyKeyHeader)
+		if key == "" {
+			return c.Next()
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			return c.Status(400).JSON(fiber.Map{"error": "Idempotency-Key is too long"})
+		}
+
+		requestHash := idempotencyRequestHash(c)
+
+		claimed, err := claimIdempotencyKey(c, db, scope, key, requestHash)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to check Idempotency-Key"})
+		}
+		if !claimed {
+			return replayIdempotentResponse(c, db, scope, key, requestHash)
+		}
+
+		claim := &idempotencyClaim{scope: scope, key: key}
+		c.Locals(idempotencyContextKey, claim)
+
+		handlerErr := c.Next()
+
+		status := c.Response().StatusCode()
+		switch {
+		case handlerErr != nil || status >= 500:
+			// A response stored by a transaction that did commit is kept.
+			_, err = db.Exec(
+				c.Context(),
+				`DELETE FROM idempotency_keys WHERE scope = $1 AND key = $2 AND completed_at IS NULL`,
+				scope, key,
+			)
+			if err != nil {
+				log.Println("idempotency: failed to release key:", err)
+			}
+		case claim.stored:
+			// Stored with the handler's changes.
+		default:
+			_, err = db.Exec(
+				c.Context(),
+				`UPDATE idempotency_keys SET response_status = $3, response_body = $4, completed_at = CURRENT_TIMESTAMP
+				 WHERE scope = $1 AND key = $2`,
+				scope, key, status, c.Response().Body(),
+			)
+			if err != nil {
+				log.Println("idempotency: failed to store response:", err)
+				_, err = db.Exec(
+					c.Context(),
+					`UPDATE idempotency_keys SET completed_at = CURRENT_TIMESTAMP WHERE scope = $1 AND key = $2`,
+					scope, key,
+				)
+				if err != nil {
+					log.Println("idempotency: failed to mark key completed:", err)
+				}
+			}
+		}
+
+		return handlerErr
+	}
+}
+
+// StoreIdempotentResponse stores the response the handler is about to send
+// with 200 in tx, the transaction holding the request's changes, so that the
+// response is kept exactly when the changes are committed. It is a no-op for
+// requests without an Idempotency-Key.
+func StoreIdempotentResponse(c *fiber.Ctx, tx pgx.Tx, response any) error {
+	claim, _ := c.Locals(idempotencyContextKey).(*idempotencyClaim)
+	if claim == nil {
+		return nil
+	}
+
+	body, err := c.App().Config().JSONEncoder(response)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		c.Context(),
+		`UPDATE idempotency_keys SET response_status = $3, response_body = $4, completed_at = CURRENT_TIMESTAMP
+		 WHERE scope = $1 AND key = $2`,
+		claim.scope, claim.key, fiber.StatusOK, body,
+	)
+	if err != nil {
+		return err
+	}
+	claim.stored = true
+	return nil
+}
+
+// claimIdempotencyKey records the key as in progress. It returns false when
+// the key is already held by a live or completed request.
+func claimIdempotencyKey(c *fiber.Ctx, db *pgxpool.Pool, scope, key, requestHash string) (bool, error) {
+	_, err := db.Exec(
+		c.Context(),
+		`DELETE FROM idempotency_keys WHERE created_at < CURRENT_TIMESTAMP - make_interval(secs => $1)`,
+		IdempotencyKeyTTL.Seconds(),
+	)
+	if err != nil {
+		return false, err
+	}
+
+	var claimed bool
+	err = db.QueryRow(
+		c.Context(),
+		`INSERT INTO idempotency_keys (scope, key, request_hash) VALUES ($1, $2, $3)
+		 ON CONFLICT (scope, key) DO UPDATE SET
+		   request_hash = EXCLUDED.request_hash,
+		   created_at = CURRENT_TIMESTAMP
+		 WHERE idempotency_keys.completed_at IS NULL
+		   AND idempotency_keys.request_hash = EXCLUDED.request_hash
+		   AND idempotency_keys.created_at < CURRENT_TIMESTAMP - make_interval(secs => $4)
+		 RETURNING true`,
+		scope, key, requestHash, idempotencyLockTimeout.Seconds(),
+	).Scan(&claimed)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	return claimed, err
+}
+
+func replayIdempotentResponse(c *fiber.Ctx, db *pgxpool.Pool, scope, key, requestHash string) error {
+	var storedHash string
+	var status *int
+	var body []byte
+	var completedAt *time.Time
+	err := db.QueryRow(
+		c.Context(),
+		`SELECT request_hash, response_status, response_body, completed_at
+		 FROM idempotency_keys WHERE scope = $1 AND key = $2`,
+		scope, key,
+	).Scan(&storedHash, &status, &body, &completedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// The original request failed and released the key in the
+		// meantime; the client can simply retry.
+		return c.Status(409).JSON(fiber.Map{"error": "request with this Idempotency-Key failed, retry"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to check Idempotency-Key"})
+	}
+
+	if storedHash != requestHash {
+		return c.Status(422).JSON(fiber.Map{"error": "Idempotency-Key was already used for a different request"})
+	}
+	if status == nil && completedAt != nil {
+		return c.Status(409).JSON(fiber.Map{"error": "request with this Idempotency-Key was already processed"})
+	}
+	if status == nil {
+		return c.Status(409).JSON(fiber.Map{"error": "request with this Idempotency-Key is still being processed"})
+	}
+
+	c.Set("Idempotent-Replayed", "true")
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Status(*status).Send(body)
+}
+
+// idempotencyRequestHash identifies the request by method, path, caller and
+// body, so that a key cannot be used to replay another client's response.
+func idempotencyRequestHash(c *fiber.Ctx) string {
+	h := sha256.New()
+	h.Write([]byte(c.Method() + " " + c.Path() + "\n"))
+	if claims := CustomerFromContext(c); claims != nil {
+		h.Write([]byte("customer:" + claims.CustomerID))
+	}
+	h.Write([]byte("\ncart:" + c.Get("X-Cart-Token") + "\n"))
+	h.Write(c.Body())
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -1,28 +1,209 @@
 package middleware
 
 import (
+	"errors"
 	"os"
+	"time"
 
 	jwtware "github.com/gofiber/contrib/jwt"
 	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Biz0n58/Zaria/backend/models"
 )
 
-func Protected(c *fiber.Ctx) error {
+const (
+	TokenIssuer     = "zaria"
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 7 * 24 * time.Hour
+
+	MFAChallengeTTL      = 5 * time.Minute
+	mfaChallengeAudience = "admin-mfa"
+
+	adminContextKey = "admin"
+)
+
+var ErrMissingSecret = errors.New("JWT_SECRET is not set")
+
+type AdminClaims struct {
+	AdminID   string `json:"admin_id"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid"`
+
+	PasswordResetRequired bool `json:"-"`
+
+	// Set instead of AdminID when the request authenticated with an API key.
+	APIKeyID   string   `json:"-"`
+	APIKeyName string   `json:"-"`
+	Scopes     []string `json:"-"`
+
+	jwt.RegisteredClaims
+}
+
+// GenerateAdminToken issues a short-lived access token bound to the session
+// family, so revoking the session also invalidates the access token.
+func GenerateAdminToken(admin models.Admin, sessionID uuid.UUID) (string, time.Time, error) {
 	secret := os.Getenv("JWT_SECRET")
 	if secret == "" {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "server configuration error",
-		})
+		return "", time.Time{}, ErrMissingSecret
 	}
 
+	now := time.Now()
+	expiresAt := now.Add(AccessTokenTTL)
+
+	claims := AdminClaims{
+		AdminID:   admin.ID.String(),
+		Email:     admin.Email,
+		Role:      admin.Role,
+		SessionID: sessionID.String(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    TokenIssuer,
+			Subject:   admin.ID.String(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return token, expiresAt, nil
+}
+
+// GenerateMFAChallengeToken issues the short-lived token returned by login
+// when the admin still has to present a second factor. It carries no session
+// and is rejected by Protected.
+func GenerateMFAChallengeToken(adminID uuid.UUID) (string, time.Time, error) {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		return "", time.Time{}, ErrMissingSecret
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(MFAChallengeTTL)
+
+	claims := jwt.RegisteredClaims{
+		Issuer:    TokenIssuer,
+		Subject:   adminID.String(),
+		Audience:  jwt.ClaimStrings{mfaChallengeAudience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return token, expiresAt, nil
+}
+
+// ParseMFAChallengeToken validates a token from GenerateMFAChallengeToken
+// and returns the admin it was issued for.
+func ParseMFAChallengeToken(tokenString string) (uuid.UUID, error) {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		return uuid.Nil, ErrMissingSecret
+	}
+
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(
+		tokenString,
+		&claims,
+		func(t *jwt.Token) (interface{}, error) { return []byte(secret), nil },
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(TokenIssuer),
+		jwt.WithAudience(mfaChallengeAudience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return uuid.Parse(claims.Subject)
+}
+
+// AdminFromContext returns the claims of the admin or API key authenticated
+// by Protected.
+func AdminFromContext(c *fiber.Ctx) *AdminClaims {
+	claims, _ := c.Locals(adminContextKey).(*AdminClaims)
+	return claims
+}
+
+// Protected accepts either an admin access token ("Bearer <jwt>") or an API
+// key ("ApiKey <key>") in the Authorization header.
+func Protected(db *pgxpool.Pool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if key, ok := apiKeyFromHeader(c); ok {
+			return verifyAPIKey(c, db, key)
+		}
+
+		secret := os.Getenv("JWT_SECRET")
+		if secret == "" {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "server configuration error",
+			})
+		}
+
+		return verifyAdminToken(c, db, secret)
+	}
+}
+
+func verifyAdminToken(c *fiber.Ctx, db *pgxpool.Pool, secret string) error {
 	return jwtware.New(jwtware.Config{
 		SigningKey: jwtware.SigningKey{
-			Key: []byte(secret),
+			JWTAlg: jwtware.HS256,
+			Key:    []byte(secret),
+		},
+		Claims: &AdminClaims{},
+		SuccessHandler: func(c *fiber.Ctx) error {
+			token, ok := c.Locals("user").(*jwt.Token)
+			if !ok {
+				return unauthorized(c)
+			}
+			claims, ok := token.Claims.(*AdminClaims)
+			if !ok || claims.Issuer != TokenIssuer || claims.AdminID == "" {
+				return unauthorized(c)
+			}
+
+			sessionID, err := uuid.Parse(claims.SessionID)
+			if err != nil {
+				return unauthorized(c)
+			}
+
+			// The role and account state are read from the database rather than
+			// trusted from the token so that changes apply immediately.
+			var disabled bool
+			err = db.QueryRow(
+				c.Context(),
+				`SELECT a.role, a.password_reset_required, a.disabled_at IS NOT NULL
+				 FROM admin_sessions s
+				 JOIN admins a ON a.id = s.admin_id
+				 WHERE s.family_id = $1 AND s.admin_id = $2
+				   AND s.revoked_at IS NULL AND s.expires_at > CURRENT_TIMESTAMP
+				 LIMIT 1`,
+				sessionID, claims.AdminID,
+			).Scan(&claims.Role, &claims.PasswordResetRequired, &disabled)
+			if err != nil || disabled {
+				return unauthorized(c)
+			}
+
+			c.Locals(adminContextKey, claims)
+			return c.Next()
 		},
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "unauthorized",
-			})
+			return unauthorized(c)
 		},
 	})(c)
 }
+
+func unauthorized(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		"error": "unauthorized",
+	})
+}
@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	RoleOwner   = "owner"
+	RoleManager = "manager"
+	RoleSupport = "support"
+)
+
+const (
+	PermOrdersRead      = "orders:read"
+	PermOrdersWrite     = "orders:write"
+	PermProductsRead    = "products:read"
+	PermProductsWrite   = "products:write"
+	PermPromotionsRead  = "promotions:read"
+	PermPromotionsWrite = "promotions:write"
+	PermShippingRead    = "shipping:read"
+	PermShippingWrite   = "shipping:write"
+	PermTaxRead         = "tax:read"
+	PermTaxWrite        = "tax:write"
+	PermAdminsManage    = "admins:manage"
+	PermAuditRead       = "audit:read"
+	PermAPIKeysManage   = "api_keys:manage"
+)
+
+// APIKeyScopes are the permissions that may be granted to an API key.
+// Managing admins and keys always requires a human.
+var APIKeyScopes = []string{
+	PermOrdersRead, PermOrdersWrite,
+	PermProductsRead, PermProductsWrite,
+	PermPromotionsRead, PermPromotionsWrite,
+	PermShippingRead, PermShippingWrite,
+	PermTaxRead, PermTaxWrite,
+	PermAuditRead,
+}
+
+var allPermissions = []string{
+	PermOrdersRead, PermOrdersWrite,
+	PermProductsRead, PermProductsWrite,
+	PermPromotionsRead, PermPromotionsWrite,
+	PermShippingRead, PermShippingWrite,
+	PermTaxRead, PermTaxWrite,
+	PermAdminsManage, PermAuditRead, PermAPIKeysManage,
+}
+
+var rolePermissions = map[string]map[string]bool{
+	RoleOwner: {
+		PermOrdersRead: true, PermOrdersWrite: true,
+		PermProductsRead: true, PermProductsWrite: true,
+		PermPromotionsRead: true, PermPromotionsWrite: true,
+		PermShippingRead: true, PermShippingWrite: true,
+		PermTaxRead: true, PermTaxWrite: true,
+		PermAdminsManage: true, PermAuditRead: true, PermAPIKeysManage: true,
+	},
+	RoleManager: {
+		PermOrdersRead: true, PermOrdersWrite: true,
+		PermProductsRead: true, PermProductsWrite: true,
+		PermPromotionsRead: true, PermPromotionsWrite: true,
+		PermShippingRead: true, PermShippingWrite: true,
+		PermTaxRead: true, PermTaxWrite: true,
+	},
+	RoleSupport: {
+		PermOrdersRead: true, PermProductsRead: true, PermPromotionsRead: true,
+		PermShippingRead: true, PermTaxRead: true,
+	},
+}
+
+func IsValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+func HasPermission(role, permission string) bool {
+	return rolePermissions[role][permission]
+}
+
+// RolePermissions lists the permissions granted to role.
+func RolePermissions(role string) []string {
+	perms := []string{}
+	for _, p := range allPermissions {
+		if rolePermissions[role][p] {
+			perms = append(perms, p)
+		}
+	}
+	return perms
+}
+
+// RequirePermission must run after Protected; it rejects admins whose role
+// does not grant permission or who still have to change their password, and
+// API keys whose scopes do not include it.
+func RequirePermission(permission string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims := AdminFromContext(c)
+		if claims == nil {
+			return unauthorized(c)
+		}
+
+		if claims.PasswordResetRequired {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "password change required",
+			})
+		}
+
+		if claims.APIKeyID != "" {
+			if !slices.Contains(claims.Scopes, permission) {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error": "forbidden",
+				})
+			}
+			return c.Next()
+		}
+
+		if !HasPermission(claims.Role, permission) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "forbidden",
+			})
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,6 @@
+-- Existing admins keep full access; new admins default to the least privileged role.
+ALTER TABLE admins ADD COLUMN IF NOT EXISTS role VARCHAR(50) NOT NULL DEFAULT 'owner';
+ALTER TABLE admins ALTER COLUMN role SET DEFAULT 'support';
+
+ALTER TABLE admins DROP CONSTRAINT IF EXISTS admins_role_check;
+ALTER TABLE admins ADD CONSTRAINT admins_role_check CHECK (role IN ('owner', 'manager', 'support'));
@@ -0,0 +1,3 @@
+ALTER TABLE admins ADD COLUMN IF NOT EXISTS password_reset_required BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE admins ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMP;
+ALTER TABLE admins ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
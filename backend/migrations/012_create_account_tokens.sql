@@ -0,0 +1,18 @@
+-- Single-use tokens for password resets and email verification. Only the
+-- SHA-256 hash of the token is stored.
+CREATE TABLE IF NOT EXISTS account_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    purpose VARCHAR(30) NOT NULL CHECK (purpose IN ('password_reset', 'email_verification')),
+    admin_id UUID REFERENCES admins(id) ON DELETE CASCADE,
+    customer_id UUID REFERENCES customers(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (num_nonnulls(admin_id, customer_id) = 1)
+);
+
+CREATE INDEX IF NOT EXISTS idx_account_tokens_admin_id ON account_tokens(admin_id);
+CREATE INDEX IF NOT EXISTS idx_account_tokens_customer_id ON account_tokens(customer_id);
+
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMP;
@@ -0,0 +1,25 @@
+-- A cart belongs either to a customer or, for guests, to whoever holds the
+-- cart token (only its SHA-256 hash is stored).
+CREATE TABLE IF NOT EXISTS carts (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    customer_id UUID REFERENCES customers(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) UNIQUE,
+    order_id UUID REFERENCES orders(id) ON DELETE SET NULL,
+    converted_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (customer_id IS NOT NULL OR token_hash IS NOT NULL)
+);
+
+-- Each customer has at most one open cart.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_carts_open_customer ON carts(customer_id) WHERE converted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS cart_items (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    cart_id UUID NOT NULL REFERENCES carts(id) ON DELETE CASCADE,
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    qty INTEGER NOT NULL CHECK (qty > 0),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (cart_id, product_id)
+);
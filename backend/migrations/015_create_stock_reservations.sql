@@ -0,0 +1,17 @@
+-- Stock taken by an order. products.stock is decremented when the
+-- reservation is made; releasing it puts the quantity back. Reservations of
+-- unpaid orders expire and are released by the sweeper.
+CREATE TABLE IF NOT EXISTS stock_reservations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    qty INTEGER NOT NULL CHECK (qty > 0),
+    expires_at TIMESTAMP NOT NULL,
+    committed_at TIMESTAMP,
+    released_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_reservations_order_id ON stock_reservations(order_id);
+CREATE INDEX IF NOT EXISTS idx_stock_reservations_open ON stock_reservations(expires_at)
+    WHERE committed_at IS NULL AND released_at IS NULL;
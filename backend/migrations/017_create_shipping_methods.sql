@@ -0,0 +1,28 @@
+ALTER TABLE products ADD COLUMN IF NOT EXISTS weight_grams INTEGER NOT NULL DEFAULT 0 CHECK (weight_grams >= 0);
+ALTER TABLE products ADD COLUMN IF NOT EXISTS length_mm INTEGER NOT NULL DEFAULT 0 CHECK (length_mm >= 0);
+ALTER TABLE products ADD COLUMN IF NOT EXISTS width_mm INTEGER NOT NULL DEFAULT 0 CHECK (width_mm >= 0);
+ALTER TABLE products ADD COLUMN IF NOT EXISTS height_mm INTEGER NOT NULL DEFAULT 0 CHECK (height_mm >= 0);
+
+-- Shipping methods offered at checkout. config holds the settings of the
+-- provider, e.g. {"amount_cents": 500} for a flat rate; see the shipping
+-- package for the other providers.
+CREATE TABLE IF NOT EXISTS shipping_methods (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    code VARCHAR(50) UNIQUE NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    provider VARCHAR(20) NOT NULL CHECK (provider IN ('flat', 'weight', 'zone')),
+    config JSONB NOT NULL DEFAULT '{}',
+    free_over_cents INTEGER CHECK (free_over_cents >= 0),
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    position INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- The rate checkout used before shipping methods were configurable.
+INSERT INTO shipping_methods (code, name, provider, config, free_over_cents)
+VALUES ('standard', 'Standard shipping', 'flat', '{"amount_cents": 500}', 5000)
+ON CONFLICT (code) DO NOTHING;
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS shipping_method VARCHAR(50);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS shipping_method_name VARCHAR(255);
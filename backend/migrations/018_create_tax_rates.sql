@@ -0,0 +1,40 @@
+ALTER TABLE products ADD COLUMN IF NOT EXISTS tax_class VARCHAR(50) NOT NULL DEFAULT 'standard';
+
+-- Tax rates per country, optionally narrowed to a region (state, province).
+-- Every rate matching the destination and the product's tax class applies,
+-- so a country-wide rate and a regional rate add up. rate_bps is in
+-- hundredths of a percent.
+CREATE TABLE IF NOT EXISTS tax_rates (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(100) NOT NULL,
+    country CHAR(2) NOT NULL,
+    region VARCHAR(100) NOT NULL DEFAULT '',
+    tax_class VARCHAR(50) NOT NULL DEFAULT 'standard',
+    rate_bps INTEGER NOT NULL CHECK (rate_bps >= 0 AND rate_bps <= 10000),
+    inclusive BOOLEAN NOT NULL DEFAULT false,
+    applies_to_shipping BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (country, region, tax_class, name)
+);
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS tax_cents INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS shipping_tax_cents INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS tax_class VARCHAR(50) NOT NULL DEFAULT 'standard';
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS tax_cents INTEGER NOT NULL DEFAULT 0;
+
+-- Tax collected per rate, as computed at checkout.
+CREATE TABLE IF NOT EXISTS order_tax_lines (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    country CHAR(2) NOT NULL,
+    region VARCHAR(100) NOT NULL DEFAULT '',
+    rate_bps INTEGER NOT NULL,
+    inclusive BOOLEAN NOT NULL,
+    taxable_cents INTEGER NOT NULL,
+    amount_cents INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_tax_lines_order_id ON order_tax_lines(order_id);
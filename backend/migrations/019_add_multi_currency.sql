@@ -0,0 +1,21 @@
+-- Exchange rates from the base currency (usd): how many units of currency
+-- one dollar buys. Products and configured amounts (shipping, promotions)
+-- are converted with these unless a product has an explicit price.
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    currency VARCHAR(3) PRIMARY KEY,
+    rate NUMERIC(20, 10) NOT NULL CHECK (rate > 0),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Explicit prices of a product in currencies other than its own.
+CREATE TABLE IF NOT EXISTS product_prices (
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    currency VARCHAR(3) NOT NULL,
+    price_cents INTEGER NOT NULL CHECK (price_cents >= 0),
+    PRIMARY KEY (product_id, currency)
+);
+
+UPDATE products SET currency = LOWER(currency) WHERE currency <> LOWER(currency);
+
+ALTER TABLE carts ADD COLUMN IF NOT EXISTS currency VARCHAR(3) NOT NULL DEFAULT 'usd';
@@ -0,0 +1,52 @@
+-- Options a product is sold in (e.g. Size with S, M, L) and the variants
+-- made from one value of each option. A product with variants is bought as
+-- one of them: the variant's own stock is used, and its price overrides the
+-- product's when set.
+CREATE TABLE IF NOT EXISTS product_options (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    option_values TEXT[] NOT NULL DEFAULT '{}',
+    position INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (product_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS product_variants (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    sku VARCHAR(100) UNIQUE NOT NULL,
+    price_cents INTEGER CHECK (price_cents >= 0),
+    stock INTEGER NOT NULL DEFAULT 0 CHECK (stock >= 0),
+    image_url VARCHAR(500),
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    position INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_product_variants_product_id ON product_variants(product_id);
+
+CREATE TABLE IF NOT EXISTS product_variant_options (
+    variant_id UUID NOT NULL REFERENCES product_variants(id) ON DELETE CASCADE,
+    option_id UUID NOT NULL REFERENCES product_options(id) ON DELETE CASCADE,
+    value TEXT NOT NULL,
+    PRIMARY KEY (variant_id, option_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_product_variant_options_option_id ON product_variant_options(option_id);
+
+-- Carts hold at most one row per product, or per variant for products with
+-- variants.
+ALTER TABLE cart_items ADD COLUMN IF NOT EXISTS variant_id UUID REFERENCES product_variants(id) ON DELETE CASCADE;
+ALTER TABLE cart_items DROP CONSTRAINT IF EXISTS cart_items_cart_id_product_id_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_cart_items_product ON cart_items(cart_id, product_id) WHERE variant_id IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_cart_items_variant ON cart_items(cart_id, variant_id) WHERE variant_id IS NOT NULL;
+
+ALTER TABLE stock_reservations ADD COLUMN IF NOT EXISTS variant_id UUID REFERENCES product_variants(id) ON DELETE CASCADE;
+
+-- Order items keep the SKU and option values as they were at checkout.
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS variant_id UUID REFERENCES product_variants(id) ON DELETE SET NULL;
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS sku VARCHAR(100);
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS variant_options JSONB NOT NULL DEFAULT '[]';
@@ -0,0 +1,3 @@
+-- Customer tokens carry the token version they were issued with; bumping it,
+-- e.g. on a password reset, signs out every existing session.
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS token_version INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+-- Three-decimal currencies can only be charged in multiples of ten of their
+-- minor unit; the difference is kept so that the parts add up to the total.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS rounding_cents INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Address struct {
+	Name       string `json:"name"`
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2"`
+	City       string `json:"city"`
+	Region     string `json:"region"`
+	PostalCode string `json:"postal_code"`
+	Country    string `json:"country"`
+	Phone      string `json:"phone"`
+}
+
+type CustomerAddress struct {
+	ID         uuid.UUID `json:"id"`
+	CustomerID uuid.UUID `json:"user_id"`
+	Label      string    `json:"label"`
+	Address
+	IsDefault bool      `json:"is_default"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+const (
+	AddressTypeShipping = "shipping"
+	AddressTypeBilling  = "billing"
+)
+
+type OrderAddress struct {
+	ID      uuid.UUID `json:"id"`
+	OrderID uuid.UUID `json:"order_id"`
+	Type    string    `json:"type"`
+	Address
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -7,8 +7,15 @@ import (
 )
 
 type Admin struct {
-	ID           uuid.UUID `json:"id"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"-"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID                    uuid.UUID  `json:"id"`
+	Email                 string     `json:"email"`
+	PasswordHash          string     `json:"-"`
+	Role                  string     `json:"role"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+	TwoFactorEnabled      bool       `json:"two_factor_enabled"`
+	FailedLoginCount      int        `json:"failed_login_count"`
+	LockedUntil           *time.Time `json:"locked_until"`
+	DisabledAt            *time.Time `json:"disabled_at"`
+	CreatedAt             time.Time  `json:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
 }
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AdminSession struct {
+	ID               uuid.UUID  `json:"id"`
+	AdminID          uuid.UUID  `json:"admin_id"`
+	FamilyID         uuid.UUID  `json:"family_id"`
+	RefreshTokenHash string     `json:"-"`
+	UserAgent        string     `json:"user_agent"`
+	IPAddress        string     `json:"ip_address"`
+	ExpiresAt        time.Time  `json:"expires_at"`
+	RotatedAt        *time.Time `json:"rotated_at,omitempty"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
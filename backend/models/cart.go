@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Cart is returned with live product data: prices and availability are read
+// when the cart is loaded, not when items were added.
+type Cart struct {
+	ID            uuid.UUID  `json:"id"`
+	CustomerID    *uuid.UUID `json:"user_id"`
+	Items         []CartItem `json:"items"`
+	SubtotalCents int        `json:"subtotal_cents"`
+	Currency      string     `json:"currency"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+type CartItem struct {
+	ID             uuid.UUID            `json:"id"`
+	ProductID      uuid.UUID            `json:"product_id"`
+	VariantID      *uuid.UUID           `json:"variant_id"`
+	SKU            *string              `json:"sku"`
+	VariantOptions []VariantOptionValue `json:"variant_options,omitempty"`
+	Name           string               `json:"name"`
+	ImageURL       string               `json:"image_url"`
+	UnitPriceCents int                  `json:"unit_price_cents"`
+	Qty            int                  `json:"qty"`
+	LineTotalCents int                  `json:"line_total_cents"`
+	AvailableStock int                  `json:"available_stock"`
+	Available      bool                 `json:"available"`
+	// Warning explains why the item cannot be checked out as it is, e.g.
+	// the product was deactivated or has less stock than requested.
+	Warning   string    `json:"warning,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
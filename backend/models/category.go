@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Category struct {
+	ID          uuid.UUID  `json:"id"`
+	ParentID    *uuid.UUID `json:"parent_id"`
+	Name        string     `json:"name"`
+	Slug        string     `json:"slug"`
+	Description string     `json:"description"`
+	Position    int        `json:"position"`
+	// Children is only filled in when categories are returned as a tree.
+	Children  []Category `json:"children,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+type Collection struct {
+	ID          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	Slug        string    `json:"slug"`
+	Description string    `json:"description"`
+	Type        string    `json:"type"`
+	// Rules select the products of a rule collection; a product must match
+	// all of them.
+	Rules []CollectionRule `json:"rules"`
+	// ProductIDs are the products of a manual collection, in order.
+	ProductIDs []uuid.UUID `json:"product_ids"`
+	IsActive   bool        `json:"is_active"`
+	Position   int         `json:"position"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+}
+
+// CollectionRule compares a product field with a value, e.g.
+// {"field": "price_cents", "operator": "lt", "value": 2000}.
+type CollectionRule struct {
+	Field    string `json:"field"`
+	Operator string `json:"operator"`
+	Value    any    `json:"value"`
+}
+
+const (
+	CollectionTypeManual = "manual"
+	CollectionTypeRule   = "rule"
+)
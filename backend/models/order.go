@@ -7,24 +7,47 @@ import (
 )
 
 type Order struct {
-	ID           uuid.UUID    `json:"id"`
-	CustomerEmail string      `json:"customer_email"`
-	Status       string       `json:"status"`
-	SubtotalCents int         `json:"subtotal_cents"`
-	ShippingCents int         `json:"shipping_cents"`
-	TotalCents   int          `json:"total_cents"`
-	Currency     string       `json:"currency"`
-	Items        []OrderItem  `json:"items,omitempty"`
-	Payment      *Payment     `json:"payment,omitempty"`
-	CreatedAt    time.Time    `json:"created_at"`
-	UpdatedAt    time.Time    `json:"updated_at"`
+	ID            uuid.UUID  `json:"id"`
+	CustomerID    *uuid.UUID `json:"user_id"`
+	CustomerEmail string     `json:"customer_email"`
+	Status        string     `json:"status"`
+	SubtotalCents int        `json:"subtotal_cents"`
+	ShippingCents int        `json:"shipping_cents"`
+	// ShippingMethod is the code of the chosen method; the name is kept as
+	// shown at checkout.
+	ShippingMethod     *string `json:"shipping_method"`
+	ShippingMethodName *string `json:"shipping_method_name"`
+	DiscountCents      int     `json:"discount_cents"`
+	// TaxCents includes tax already contained in tax-inclusive prices.
+	TaxCents         int `json:"tax_cents"`
+	ShippingTaxCents int `json:"shipping_tax_cents"`
+	// RoundingCents is added to the total of three-decimal currencies so it
+	// can be charged.
+	RoundingCents   int              `json:"rounding_cents"`
+	TotalCents      int              `json:"total_cents"`
+	Currency        string           `json:"currency"`
+	Items           []OrderItem      `json:"items,omitempty"`
+	Payment         *Payment         `json:"payment,omitempty"`
+	ShippingAddress *OrderAddress    `json:"shipping_address,omitempty"`
+	BillingAddress  *OrderAddress    `json:"billing_address,omitempty"`
+	Promotions      []OrderPromotion `json:"promotions,omitempty"`
+	TaxLines        []OrderTaxLine   `json:"tax_lines,omitempty"`
+	CreatedAt       time.Time        `json:"created_at"`
+	UpdatedAt       time.Time        `json:"updated_at"`
 }
 
 type OrderItem struct {
-	ID                 uuid.UUID `json:"id"`
-	OrderID            uuid.UUID `json:"order_id"`
-	ProductID          uuid.UUID `json:"product_id"`
-	NameSnapshot       string    `json:"name_snapshot"`
-	PriceCentsSnapshot int       `json:"price_cents_snapshot"`
-	Qty                int       `json:"qty"`
+	ID        uuid.UUID `json:"id"`
+	OrderID   uuid.UUID `json:"order_id"`
+	ProductID uuid.UUID `json:"product_id"`
+	// VariantID is cleared when the variant is deleted; SKU and
+	// VariantOptions are kept as they were at checkout.
+	VariantID          *uuid.UUID           `json:"variant_id"`
+	SKU                *string              `json:"sku"`
+	VariantOptions     []VariantOptionValue `json:"variant_options"`
+	NameSnapshot       string               `json:"name_snapshot"`
+	PriceCentsSnapshot int                  `json:"price_cents_snapshot"`
+	Qty                int                  `json:"qty"`
+	TaxClass           string               `json:"tax_class"`
+	TaxCents           int                  `json:"tax_cents"`
 }
@@ -14,7 +14,33 @@ type Product struct {
 	Currency    string    `json:"currency"`
 	ImageURL    string    `json:"image_url"`
 	Stock       int       `json:"stock"`
-	IsActive    bool      `json:"is_active"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	WeightGrams int       `json:"weight_grams"`
+	LengthMM    int       `json:"length_mm"`
+	WidthMM     int       `json:"width_mm"`
+	HeightMM    int       `json:"height_mm"`
+	TaxClass    string    `json:"tax_class"`
+	// Prices are explicit prices in other currencies; in any other
+	// currency the price is converted with the exchange rates.
+	Prices      []ProductPrice `json:"prices"`
+	CategoryIDs []uuid.UUID    `json:"category_ids"`
+	IsActive    bool           `json:"is_active"`
+	// Highlight is only set for search results.
+	Highlight *ProductHighlight `json:"highlight,omitempty"`
+	// Options and Variants are only loaded for a single product.
+	Options   []ProductOption  `json:"options,omitempty"`
+	Variants  []ProductVariant `json:"variants,omitempty"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+// ProductHighlight holds the HTML-escaped name and description snippet of a
+// search result with the matched terms wrapped in <mark>.
+type ProductHighlight struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type ProductPrice struct {
+	Currency   string `json:"currency"`
+	PriceCents int    `json:"price_cents"`
 }
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ProductOption struct {
+	ID        uuid.UUID `json:"id"`
+	ProductID uuid.UUID `json:"product_id"`
+	Name      string    `json:"name"`
+	Values    []string  `json:"values"`
+	Position  int       `json:"position"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type ProductVariant struct {
+	ID        uuid.UUID `json:"id"`
+	ProductID uuid.UUID `json:"product_id"`
+	SKU       string    `json:"sku"`
+	// PriceCents overrides the product's price, in the product's currency.
+	PriceCents *int `json:"price_cents"`
+	Stock      int  `json:"stock"`
+	// ImageURL overrides the product's image.
+	ImageURL  *string              `json:"image_url"`
+	IsActive  bool                 `json:"is_active"`
+	Position  int                  `json:"position"`
+	Options   []VariantOptionValue `json:"options"`
+	CreatedAt time.Time            `json:"created_at"`
+	UpdatedAt time.Time            `json:"updated_at"`
+}
+
+// VariantOptionValue is the value a variant has for one of the product's
+// options, e.g. Size M.
+type VariantOptionValue struct {
+	Option string `json:"option"`
+	Value  string `json:"value"`
+}
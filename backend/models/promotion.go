@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Promotion struct {
+	ID               uuid.UUID   `json:"id"`
+	Code             string      `json:"code"`
+	Description      string      `json:"description"`
+	Type             string      `json:"type"`
+	Value            int         `json:"value"`
+	Scope            string      `json:"scope"`
+	ProductIDs       []uuid.UUID `json:"product_ids"`
+	CategoryIDs      []uuid.UUID `json:"category_ids"`
+	MinSubtotalCents int         `json:"min_subtotal_cents"`
+	UsageLimit       *int        `json:"usage_limit"`
+	PerCustomerLimit *int        `json:"per_customer_limit"`
+	StartsAt         *time.Time  `json:"starts_at"`
+	EndsAt           *time.Time  `json:"ends_at"`
+	IsActive         bool        `json:"is_active"`
+	TimesUsed        int         `json:"times_used"`
+	CreatedAt        time.Time   `json:"created_at"`
+	UpdatedAt        time.Time   `json:"updated_at"`
+}
+
+type OrderPromotion struct {
+	ID                    uuid.UUID  `json:"id"`
+	OrderID               uuid.UUID  `json:"order_id"`
+	PromotionID           *uuid.UUID `json:"promotion_id"`
+	Code                  string     `json:"code"`
+	Type                  string     `json:"type"`
+	DiscountCents         int        `json:"discount_cents"`
+	ShippingDiscountCents int        `json:"shipping_discount_cents"`
+	CreatedAt             time.Time  `json:"created_at"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ShippingMethod struct {
+	ID            uuid.UUID       `json:"id"`
+	Code          string          `json:"code"`
+	Name          string          `json:"name"`
+	Provider      string          `json:"provider"`
+	Config        json.RawMessage `json:"config"`
+	FreeOverCents *int            `json:"free_over_cents"`
+	IsActive      bool            `json:"is_active"`
+	Position      int             `json:"position"`
+	CreatedAt     time.Time       `json:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+}
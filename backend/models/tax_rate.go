@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type TaxRate struct {
+	ID                uuid.UUID `json:"id"`
+	Name              string    `json:"name"`
+	Country           string    `json:"country"`
+	Region            string    `json:"region"`
+	TaxClass          string    `json:"tax_class"`
+	RateBPS           int       `json:"rate_bps"`
+	Inclusive         bool      `json:"inclusive"`
+	AppliesToShipping bool      `json:"applies_to_shipping"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+type OrderTaxLine struct {
+	ID           uuid.UUID `json:"id"`
+	OrderID      uuid.UUID `json:"order_id"`
+	Name         string    `json:"name"`
+	Country      string    `json:"country"`
+	Region       string    `json:"region"`
+	RateBPS      int       `json:"rate_bps"`
+	Inclusive    bool      `json:"inclusive"`
+	TaxableCents int       `json:"taxable_cents"`
+	AmountCents  int       `json:"amount_cents"`
+	CreatedAt    time.Time `json:"created_at"`
+}
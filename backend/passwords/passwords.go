@@ -0,0 +1,18 @@
+// Package passwords generates the random passwords handed out to admins who
+// must replace them on first login.
+package passwords
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+)
+
+// Temporary returns a random password that is shown once and replaced by the
+// admin on first login.
+func Temporary() (string, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,145 @@
+// Package pricing computes order totals. Checkout uses the same calculation
+// for quotes and for orders so that a quote always matches the charge.
+package pricing
+
+import (
+	"github.com/Biz0n58/Zaria/backend/currency"
+	"github.com/Biz0n58/Zaria/backend/models"
+	"github.com/Biz0n58/Zaria/backend/shipping"
+	"github.com/Biz0n58/Zaria/backend/tax"
+	"github.com/google/uuid"
+)
+
+const DefaultCurrency = "usd"
+
+type Line struct {
+	ProductID uuid.UUID `json:"product_id"`
+	// VariantID, SKU and VariantOptions are set for products sold in
+	// variants.
+	VariantID      *uuid.UUID                  `json:"variant_id,omitempty"`
+	SKU            string                      `json:"sku,omitempty"`
+	VariantOptions []models.VariantOptionValue `json:"variant_options,omitempty"`
+	Name           string                      `json:"name"`
+	UnitPriceCents int                         `json:"unit_price_cents"`
+	Qty            int                         `json:"qty"`
+	LineTotalCents int                         `json:"line_total_cents"`
+	// DiscountCents is this line's share of the order discount.
+	DiscountCents int `json:"discount_cents"`
+	// TaxCents is the tax on the discounted line total.
+	TaxCents int `json:"tax_cents"`
+
+	// CategoryIDs are used to match category-scoped promotions.
+	CategoryIDs []uuid.UUID `json:"-"`
+	TaxClass    string      `json:"-"`
+	// WeightGrams and VolumeMM3 are per unit and used for shipping rates.
+	WeightGrams int   `json:"-"`
+	VolumeMM3   int64 `json:"-"`
+}
+
+type Request struct {
+	Lines    []Line
+	Currency string
+	// Shipping is the chosen shipping option; nil means nothing is charged
+	// for shipping yet, e.g. for a quote without a destination.
+	Shipping  *shipping.Option
+	Promotion *Promotion
+	// Tax computes the tax for an order shipped to Country and Region; nil
+	// means no tax is charged yet, e.g. for a quote without a destination.
+	Tax     tax.TaxCalculator
+	Country string
+	Region  string
+}
+
+type Quote struct {
+	Lines          []Line           `json:"lines"`
+	SubtotalCents  int              `json:"subtotal_cents"`
+	ShippingCents  int              `json:"shipping_cents"`
+	ShippingMethod *shipping.Option `json:"shipping_method,omitempty"`
+	DiscountCents  int              `json:"discount_cents"`
+	// TaxCents is all tax on the order, including tax that is already
+	// part of tax-inclusive prices; only the rest is added to TotalCents.
+	TaxCents         int        `json:"tax_cents"`
+	ShippingTaxCents int        `json:"shipping_tax_cents"`
+	TaxLines         []tax.Line `json:"tax_lines"`
+	// RoundingCents rounds the total to an amount that can be charged in
+	// the currency; it is only ever non-zero for three-decimal currencies.
+	RoundingCents int               `json:"rounding_cents"`
+	TotalCents    int               `json:"total_cents"`
+	Currency      string            `json:"currency"`
+	Promotion     *AppliedPromotion `json:"promotion,omitempty"`
+}
+
+// Calculate prices the lines of req. Line totals are filled in from the unit
+// price and quantity. A promotion that cannot be applied to the lines is
+// reported as a *PromotionError. Tax is charged on the discounted amounts.
+func Calculate(req Request) (Quote, error) {
+	q := Quote{
+		Lines:    make([]Line, 0, len(req.Lines)),
+		Currency: req.Currency,
+		TaxLines: []tax.Line{},
+	}
+	if q.Currency == "" {
+		q.Currency = DefaultCurrency
+	}
+
+	for _, l := range req.Lines {
+		l.LineTotalCents = l.UnitPriceCents * l.Qty
+		l.DiscountCents = 0
+		q.SubtotalCents += l.LineTotalCents
+		q.Lines = append(q.Lines, l)
+	}
+
+	if req.Shipping != nil {
+		q.ShippingMethod = req.Shipping
+		q.ShippingCents = req.Shipping.AmountCents
+	}
+
+	if req.Promotion != nil {
+		applied, err := applyPromotion(&q, *req.Promotion)
+		if err != nil {
+			return q, err
+		}
+		q.Promotion = applied
+	}
+
+	exclusiveTaxCents := 0
+	if req.Tax != nil {
+		items := make([]tax.Item, len(q.Lines))
+		for i, l := range q.Lines {
+			items[i] = tax.Item{TaxClass: l.TaxClass, AmountCents: l.LineTotalCents - l.DiscountCents}
+		}
+		res, err := req.Tax.Calculate(tax.Request{
+			Country:       req.Country,
+			Region:        req.Region,
+			Items:         items,
+			ShippingCents: q.ShippingCents,
+		})
+		if err != nil {
+			return q, err
+		}
+		for i := range q.Lines {
+			q.Lines[i].TaxCents = res.ItemTaxCents[i]
+		}
+		q.ShippingTaxCents = res.ShippingTaxCents
+		q.TaxCents = res.TaxCents
+		q.TaxLines = res.Lines
+		exclusiveTaxCents = res.ExclusiveCents
+	}
+
+	total := q.SubtotalCents - q.DiscountCents + q.ShippingCents + exclusiveTaxCents
+	q.TotalCents = currency.Chargeable(total, q.Currency)
+	q.RoundingCents = q.TotalCents - total
+
+	return q, nil
+}
+
+// Parcel describes the lines for shipping rate providers.
+func Parcel(lines []Line, country string) shipping.Parcel {
+	p := shipping.Parcel{Country: country}
+	for _, l := range lines {
+		p.SubtotalCents += l.UnitPriceCents * l.Qty
+		p.WeightGrams += l.WeightGrams * l.Qty
+		p.VolumeMM3 += l.VolumeMM3 * int64(l.Qty)
+	}
+	return p
+}
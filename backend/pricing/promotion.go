@@ -0,0 +1,124 @@
+package pricing
+
+import (
+	"slices"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+const (
+	PromotionPercentage   = "percentage"
+	PromotionFixedAmount  = "fixed_amount"
+	PromotionFreeShipping = "free_shipping"
+
+	ScopeOrder      = "order"
+	ScopeProducts   = "products"
+	ScopeCategories = "categories"
+)
+
+// Promotion is the part of a promotion that affects prices. Dates, activity
+// and usage limits are checked by the caller before pricing.
+type Promotion struct {
+	ID   uuid.UUID
+	Code string
+	Type string
+	// Value is a percentage (1-100) or an amount in cents, depending on Type.
+	Value            int
+	Scope            string
+	ProductIDs       []uuid.UUID
+	CategoryIDs      []uuid.UUID
+	MinSubtotalCents int
+}
+
+type AppliedPromotion struct {
+	ID                    uuid.UUID `json:"-"`
+	Code                  string    `json:"code"`
+	Type                  string    `json:"type"`
+	DiscountCents         int       `json:"discount_cents"`
+	ShippingDiscountCents int       `json:"shipping_discount_cents"`
+}
+
+// PromotionError explains why a promotion does not apply to a cart.
+type PromotionError struct {
+	Reason string
+}
+
+func (e *PromotionError) Error() string {
+	return e.Reason
+}
+
+// applies reports whether the promotion covers the line.
+func (p Promotion) applies(l Line) bool {
+	switch p.Scope {
+	case ScopeProducts:
+		return slices.Contains(p.ProductIDs, l.ProductID)
+	case ScopeCategories:
+		for _, id := range l.CategoryIDs {
+			if slices.Contains(p.CategoryIDs, id) {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+// applyPromotion sets the discount on q and spreads it over the eligible
+// lines in proportion to their totals.
+func applyPromotion(q *Quote, p Promotion) (*AppliedPromotion, error) {
+	if q.SubtotalCents < p.MinSubtotalCents {
+		return nil, &PromotionError{Reason: "promo code requires a subtotal of at least " + strconv.Itoa(p.MinSubtotalCents) + " cents"}
+	}
+
+	eligible := []int{}
+	eligibleCents := 0
+	for i, l := range q.Lines {
+		if p.applies(l) {
+			eligible = append(eligible, i)
+			eligibleCents += l.LineTotalCents
+		}
+	}
+	if len(eligible) == 0 {
+		return nil, &PromotionError{Reason: "promo code does not apply to any item in the cart"}
+	}
+
+	applied := &AppliedPromotion{ID: p.ID, Code: p.Code, Type: p.Type}
+
+	var discount int
+	switch p.Type {
+	case PromotionPercentage:
+		discount = eligibleCents * p.Value / 100
+	case PromotionFixedAmount:
+		discount = min(p.Value, eligibleCents)
+	case PromotionFreeShipping:
+		applied.ShippingDiscountCents = q.ShippingCents
+		q.ShippingCents = 0
+		return applied, nil
+	default:
+		return nil, &PromotionError{Reason: "promo code is not valid"}
+	}
+
+	allocated := 0
+	for _, i := range eligible {
+		share := 0
+		if eligibleCents > 0 {
+			share = discount * q.Lines[i].LineTotalCents / eligibleCents
+		}
+		q.Lines[i].DiscountCents = share
+		allocated += share
+	}
+	// Hand out the cents lost to rounding one by one.
+	for n := 0; allocated < discount; n++ {
+		i := eligible[n%len(eligible)]
+		if q.Lines[i].DiscountCents < q.Lines[i].LineTotalCents {
+			q.Lines[i].DiscountCents++
+			allocated++
+		}
+	}
+
+	q.DiscountCents = discount
+	applied.DiscountCents = discount
+	return applied, nil
+}
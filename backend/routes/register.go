@@ -5,30 +5,140 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 
 	"github.com/Biz0n58/Zaria/backend/handlers"
+	"github.com/Biz0n58/Zaria/backend/mailer"
 	"github.com/Biz0n58/Zaria/backend/middleware"
 )
 
-func Register(app *fiber.App, db *pgxpool.Pool) {
-	adminHandler := handlers.NewAdminHandler(db)
+func Register(app *fiber.App, db *pgxpool.Pool, mail mailer.Mailer) {
+	adminHandler := handlers.NewAdminHandler(db, mail)
 	productHandler := handlers.NewProductHandler(db)
+	productVariantHandler := handlers.NewProductVariantHandler(db)
+	categoryHandler := handlers.NewCategoryHandler(db)
+	collectionHandler := handlers.NewCollectionHandler(db)
 	checkoutHandler := handlers.NewCheckoutHandler(db)
 	paymentHandler := handlers.NewPaymentHandler(db)
+	auditHandler := handlers.NewAuditHandler(db)
+	apiKeyHandler := handlers.NewAPIKeyHandler(db)
+	customerHandler := handlers.NewCustomerHandler(db, mail)
+	orderHandler := handlers.NewOrderHandler(db)
+	cartHandler := handlers.NewCartHandler(db)
+	promotionHandler := handlers.NewPromotionHandler(db)
+	shippingMethodHandler := handlers.NewShippingMethodHandler(db)
+	taxRateHandler := handlers.NewTaxRateHandler(db)
+	exchangeRateHandler := handlers.NewExchangeRateHandler(db)
 
 	app.Post("/api/admin/auth/login", adminHandler.Login)
+	app.Post("/api/admin/auth/refresh", adminHandler.Refresh)
+	app.Post("/api/admin/auth/logout", adminHandler.Logout)
+	app.Post("/api/admin/auth/2fa", adminHandler.VerifyTwoFactor)
+	app.Post("/api/admin/auth/password-reset/request", adminHandler.RequestPasswordReset)
+	app.Post("/api/admin/auth/password-reset/confirm", adminHandler.ConfirmPasswordReset)
 
-	admin := app.Group("/api/admin", middleware.Protected)
-	admin.Get("/orders", adminHandler.GetOrders)
-	admin.Get("/orders/:id", adminHandler.GetOrder)
-	admin.Patch("/orders/:id/status", adminHandler.UpdateOrderStatus)
-	admin.Get("/products", productHandler.GetProducts)
-	admin.Post("/products", productHandler.CreateProduct)
-	admin.Put("/products/:id", productHandler.UpdateProduct)
-	admin.Delete("/products/:id", productHandler.DeleteProduct)
+	admin := app.Group("/api/admin", middleware.Protected(db), middleware.Audit(db))
+	admin.Get("/orders", middleware.RequirePermission(middleware.PermOrdersRead), adminHandler.GetOrders)
+	admin.Get("/orders/:id", middleware.RequirePermission(middleware.PermOrdersRead), adminHandler.GetOrder)
+	admin.Patch("/orders/:id/status", middleware.RequirePermission(middleware.PermOrdersWrite), adminHandler.UpdateOrderStatus)
+	admin.Get("/products", middleware.RequirePermission(middleware.PermProductsRead), productHandler.GetProducts)
+	admin.Post("/products", middleware.RequirePermission(middleware.PermProductsWrite), productHandler.CreateProduct)
+	admin.Put("/products/:id", middleware.RequirePermission(middleware.PermProductsWrite), productHandler.UpdateProduct)
+	admin.Delete("/products/:id", middleware.RequirePermission(middleware.PermProductsWrite), productHandler.DeleteProduct)
+	admin.Get("/products/:id/options", middleware.RequirePermission(middleware.PermProductsRead), productVariantHandler.ListOptions)
+	admin.Post("/products/:id/options", middleware.RequirePermission(middleware.PermProductsWrite), productVariantHandler.CreateOption)
+	admin.Put("/products/:id/options/:option_id", middleware.RequirePermission(middleware.PermProductsWrite), productVariantHandler.UpdateOption)
+	admin.Delete("/products/:id/options/:option_id", middleware.RequirePermission(middleware.PermProductsWrite), productVariantHandler.DeleteOption)
+	admin.Get("/products/:id/variants", middleware.RequirePermission(middleware.PermProductsRead), productVariantHandler.ListVariants)
+	admin.Post("/products/:id/variants", middleware.RequirePermission(middleware.PermProductsWrite), productVariantHandler.CreateVariant)
+	admin.Put("/products/:id/variants/:variant_id", middleware.RequirePermission(middleware.PermProductsWrite), productVariantHandler.UpdateVariant)
+	admin.Delete("/products/:id/variants/:variant_id", middleware.RequirePermission(middleware.PermProductsWrite), productVariantHandler.DeleteVariant)
+
+	admin.Get("/categories", middleware.RequirePermission(middleware.PermProductsRead), categoryHandler.ListCategories)
+	admin.Post("/categories", middleware.RequirePermission(middleware.PermProductsWrite), categoryHandler.CreateCategory)
+	admin.Put("/categories/:id", middleware.RequirePermission(middleware.PermProductsWrite), categoryHandler.UpdateCategory)
+	admin.Delete("/categories/:id", middleware.RequirePermission(middleware.PermProductsWrite), categoryHandler.DeleteCategory)
+
+	admin.Get("/collections", middleware.RequirePermission(middleware.PermProductsRead), collectionHandler.ListCollections)
+	admin.Get("/collections/:id", middleware.RequirePermission(middleware.PermProductsRead), collectionHandler.GetCollection)
+	admin.Post("/collections", middleware.RequirePermission(middleware.PermProductsWrite), collectionHandler.CreateCollection)
+	admin.Put("/collections/:id", middleware.RequirePermission(middleware.PermProductsWrite), collectionHandler.UpdateCollection)
+	admin.Delete("/collections/:id", middleware.RequirePermission(middleware.PermProductsWrite), collectionHandler.DeleteCollection)
+
+	admin.Get("/promotions", middleware.RequirePermission(middleware.PermPromotionsRead), promotionHandler.ListPromotions)
+	admin.Get("/promotions/:id", middleware.RequirePermission(middleware.PermPromotionsRead), promotionHandler.GetPromotion)
+	admin.Post("/promotions", middleware.RequirePermission(middleware.PermPromotionsWrite), promotionHandler.CreatePromotion)
+	admin.Put("/promotions/:id", middleware.RequirePermission(middleware.PermPromotionsWrite), promotionHandler.UpdatePromotion)
+	admin.Delete("/promotions/:id", middleware.RequirePermission(middleware.PermPromotionsWrite), promotionHandler.DeletePromotion)
+
+	admin.Get("/shipping-methods", middleware.RequirePermission(middleware.PermShippingRead), shippingMethodHandler.ListShippingMethods)
+	admin.Get("/shipping-methods/:id", middleware.RequirePermission(middleware.PermShippingRead), shippingMethodHandler.GetShippingMethod)
+	admin.Post("/shipping-methods", middleware.RequirePermission(middleware.PermShippingWrite), shippingMethodHandler.CreateShippingMethod)
+	admin.Put("/shipping-methods/:id", middleware.RequirePermission(middleware.PermShippingWrite), shippingMethodHandler.UpdateShippingMethod)
+	admin.Delete("/shipping-methods/:id", middleware.RequirePermission(middleware.PermShippingWrite), shippingMethodHandler.DeleteShippingMethod)
+
+	admin.Get("/tax-rates", middleware.RequirePermission(middleware.PermTaxRead), taxRateHandler.ListTaxRates)
+	admin.Get("/tax-rates/:id", middleware.RequirePermission(middleware.PermTaxRead), taxRateHandler.GetTaxRate)
+	admin.Post("/tax-rates", middleware.RequirePermission(middleware.PermTaxWrite), taxRateHandler.CreateTaxRate)
+	admin.Put("/tax-rates/:id", middleware.RequirePermission(middleware.PermTaxWrite), taxRateHandler.UpdateTaxRate)
+	admin.Delete("/tax-rates/:id", middleware.RequirePermission(middleware.PermTaxWrite), taxRateHandler.DeleteTaxRate)
+
+	admin.Get("/exchange-rates", middleware.RequirePermission(middleware.PermProductsRead), exchangeRateHandler.ListExchangeRates)
+	admin.Put("/exchange-rates/:currency", middleware.RequirePermission(middleware.PermProductsWrite), exchangeRateHandler.PutExchangeRate)
+	admin.Delete("/exchange-rates/:currency", middleware.RequirePermission(middleware.PermProductsWrite), exchangeRateHandler.DeleteExchangeRate)
+
+	admin.Get("/audit", middleware.RequirePermission(middleware.PermAuditRead), auditHandler.GetAuditLog)
+
+	apiKeys := admin.Group("/api-keys", middleware.RequirePermission(middleware.PermAPIKeysManage))
+	apiKeys.Get("/", apiKeyHandler.ListAPIKeys)
+	apiKeys.Post("/", apiKeyHandler.CreateAPIKey)
+	apiKeys.Delete("/:id", apiKeyHandler.RevokeAPIKey)
+
+	admin.Put("/admins/me/password", adminHandler.ChangeOwnPassword)
+	admin.Post("/admins/me/2fa/setup", adminHandler.SetupTwoFactor)
+	admin.Post("/admins/me/2fa/confirm", adminHandler.ConfirmTwoFactor)
+	admin.Post("/admins/me/2fa/disable", adminHandler.DisableTwoFactor)
+	admins := admin.Group("/admins", middleware.RequirePermission(middleware.PermAdminsManage))
+	admins.Get("/", adminHandler.ListAdmins)
+	admins.Post("/", adminHandler.InviteAdmin)
+	admins.Patch("/:id", adminHandler.UpdateAdmin)
+	admins.Post("/:id/disable", adminHandler.DisableAdmin)
+	admins.Post("/:id/enable", adminHandler.EnableAdmin)
+	admins.Post("/:id/unlock", adminHandler.UnlockAdmin)
+	admins.Post("/:id/reset-password", adminHandler.ForcePasswordReset)
+	admins.Delete("/:id", adminHandler.DeleteAdmin)
+
+	app.Post("/api/auth/register", customerHandler.Register)
+	app.Post("/api/auth/login", customerHandler.Login)
+	app.Post("/api/auth/password-reset/request", customerHandler.RequestPasswordReset)
+	app.Post("/api/auth/password-reset/confirm", customerHandler.ConfirmPasswordReset)
+	app.Post("/api/auth/verify-email", customerHandler.VerifyEmail)
+
+	me := app.Group("/api/me", middleware.CustomerProtected(db))
+	me.Get("/", customerHandler.GetMe)
+	me.Put("/", customerHandler.UpdateMe)
+	me.Post("/verify-email/resend", customerHandler.ResendVerificationEmail)
+	me.Get("/orders", customerHandler.GetMyOrders)
+	me.Get("/orders/:id", customerHandler.GetMyOrder)
+	me.Get("/addresses", customerHandler.ListAddresses)
+	me.Post("/addresses", customerHandler.CreateAddress)
+	me.Put("/addresses/:id", customerHandler.UpdateAddress)
+	me.Delete("/addresses/:id", customerHandler.DeleteAddress)
 
 	app.Get("/api/products", productHandler.GetProducts)
+	app.Get("/api/products/suggest", productHandler.SuggestProducts)
 	app.Get("/api/products/:id", productHandler.GetProduct)
+	app.Get("/api/categories", categoryHandler.GetCategoryTree)
+	app.Get("/api/categories/:slug", categoryHandler.GetCategoryBySlug)
+	app.Get("/api/collections", collectionHandler.GetActiveCollections)
+
+	cart := app.Group("/api/cart", middleware.OptionalCustomer(db))
+	cart.Post("/", cartHandler.CreateCart)
+	cart.Get("/:id", cartHandler.GetCart)
+	cart.Post("/:id/items", cartHandler.AddItem)
+	cart.Put("/:id/items/:product_id", cartHandler.UpdateItem)
+	cart.Delete("/:id/items/:product_id", cartHandler.RemoveItem)
 
-	app.Post("/api/checkout", checkoutHandler.CreateOrder)
-	app.Post("/api/payments/stripe/create-intent", paymentHandler.CreateStripeIntent)
+	app.Post("/api/checkout", middleware.OptionalCustomer(db), middleware.Idempotent(db, "checkout"), checkoutHandler.CreateOrder)
+	app.Post("/api/checkout/quote", middleware.OptionalCustomer(db), checkoutHandler.Quote)
+	app.Get("/api/orders/:id", orderHandler.GetOrder)
+	app.Post("/api/payments/stripe/create-intent", middleware.Idempotent(db, "create-intent"), paymentHandler.CreateStripeIntent)
 	app.Post("/api/payments/stripe/webhook", paymentHandler.StripeWebhook)
 }
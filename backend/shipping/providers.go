@@ -0,0 +1,134 @@
+package shipping
+
+import (
+	"errors"
+	"slices"
+	"strings"
+)
+
+// FlatRate charges the same amount for every parcel.
+//
+//	{"amount_cents": 500}
+type FlatRate struct {
+	AmountCents int `json:"amount_cents"`
+}
+
+func (f *FlatRate) Rate(Parcel) (int, bool) {
+	return f.AmountCents, true
+}
+
+func (f *FlatRate) validate() error {
+	if f.AmountCents < 0 {
+		return errors.New("amount_cents must be non-negative")
+	}
+	return nil
+}
+
+// WeightBased charges by the first bracket the parcel weight fits in. When
+// VolumetricDivisor is set the billable weight is the larger of the actual
+// weight and volume/divisor (mm³ per gram, 5000 is common).
+//
+//	{"brackets": [{"max_grams": 1000, "amount_cents": 400},
+//	              {"max_grams": 5000, "amount_cents": 900}],
+//	 "volumetric_divisor": 5000}
+//
+// Parcels heavier than the last bracket cannot be shipped.
+type WeightBased struct {
+	Brackets          []WeightBracket `json:"brackets"`
+	VolumetricDivisor int64           `json:"volumetric_divisor"`
+}
+
+type WeightBracket struct {
+	MaxGrams    int `json:"max_grams"`
+	AmountCents int `json:"amount_cents"`
+}
+
+func (w *WeightBased) Rate(p Parcel) (int, bool) {
+	grams := p.WeightGrams
+	if w.VolumetricDivisor > 0 {
+		if v := int(p.VolumeMM3 / w.VolumetricDivisor); v > grams {
+			grams = v
+		}
+	}
+
+	for _, b := range w.Brackets {
+		if grams <= b.MaxGrams {
+			return b.AmountCents, true
+		}
+	}
+	return 0, false
+}
+
+func (w *WeightBased) validate() error {
+	if len(w.Brackets) == 0 {
+		return errors.New("brackets are required")
+	}
+	if w.VolumetricDivisor < 0 {
+		return errors.New("volumetric_divisor must be non-negative")
+	}
+	prev := -1
+	for _, b := range w.Brackets {
+		if b.MaxGrams <= prev {
+			return errors.New("brackets must be sorted by increasing max_grams")
+		}
+		if b.AmountCents < 0 {
+			return errors.New("amount_cents must be non-negative")
+		}
+		prev = b.MaxGrams
+	}
+	return nil
+}
+
+// ZoneTable charges by destination country. Countries in no zone use
+// DefaultCents, or cannot be shipped to when it is not set.
+//
+//	{"zones": [{"name": "Domestic", "countries": ["US"], "amount_cents": 500},
+//	           {"name": "North America", "countries": ["CA", "MX"], "amount_cents": 1500}],
+//	 "default_cents": 3000}
+type ZoneTable struct {
+	Zones        []Zone `json:"zones"`
+	DefaultCents *int   `json:"default_cents"`
+}
+
+type Zone struct {
+	Name        string   `json:"name"`
+	Countries   []string `json:"countries"`
+	AmountCents int      `json:"amount_cents"`
+}
+
+func (z *ZoneTable) Rate(p Parcel) (int, bool) {
+	country := strings.ToUpper(p.Country)
+	if country != "" {
+		for _, zone := range z.Zones {
+			if slices.Contains(zone.Countries, country) {
+				return zone.AmountCents, true
+			}
+		}
+	}
+	if z.DefaultCents != nil {
+		return *z.DefaultCents, true
+	}
+	return 0, false
+}
+
+func (z *ZoneTable) validate() error {
+	if len(z.Zones) == 0 && z.DefaultCents == nil {
+		return errors.New("zones or default_cents are required")
+	}
+	for i := range z.Zones {
+		zone := &z.Zones[i]
+		if len(zone.Countries) == 0 {
+			return errors.New("every zone needs countries")
+		}
+		if zone.AmountCents < 0 {
+			return errors.New("amount_cents must be non-negative")
+		}
+		for j, c := range zone.Countries {
+			zone.Countries[j] = strings.ToUpper(strings.TrimSpace(c))
+		}
+	}
+	if z.DefaultCents != nil && *z.DefaultCents < 0 {
+		return errors.New("default_cents must be non-negative")
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+// Package shipping computes the shipping options offered at checkout from
+// the shipping methods configured by admins.
+package shipping
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+)
+
+const (
+	ProviderFlat   = "flat"
+	ProviderWeight = "weight"
+	ProviderZone   = "zone"
+)
+
+// Parcel describes what is being shipped and where to.
+type Parcel struct {
+	WeightGrams   int
+	VolumeMM3     int64
+	SubtotalCents int
+	// Country is the ISO code of the destination; empty when not known yet,
+	// e.g. for a quote without an address.
+	Country string
+}
+
+// ShippingRateProvider prices a parcel. ok is false when the method cannot
+// ship it, for example to a country outside every zone.
+type ShippingRateProvider interface {
+	Rate(p Parcel) (cents int, ok bool)
+}
+
+// Method is a configured shipping method.
+type Method struct {
+	Code     string
+	Name     string
+	Provider ShippingRateProvider
+	// FreeOverCents makes the method free for subtotals at or above it.
+	FreeOverCents *int
+}
+
+type Option struct {
+	Code        string `json:"code"`
+	Name        string `json:"name"`
+	AmountCents int    `json:"amount_cents"`
+}
+
+// NewProvider builds the provider of the given kind from its JSON config and
+// validates the config.
+func NewProvider(kind string, config json.RawMessage) (ShippingRateProvider, error) {
+	if len(config) == 0 {
+		config = json.RawMessage("{}")
+	}
+
+	var p interface {
+		ShippingRateProvider
+		validate() error
+	}
+	switch kind {
+	case ProviderFlat:
+		p = &FlatRate{}
+	case ProviderWeight:
+		p = &WeightBased{}
+	case ProviderZone:
+		p = &ZoneTable{}
+	default:
+		return nil, errors.New("provider must be flat, weight or zone")
+	}
+
+	if err := json.Unmarshal(config, p); err != nil {
+		return nil, errors.New("invalid config: " + err.Error())
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Options returns the methods that can ship the parcel, cheapest first.
+func Options(methods []Method, p Parcel) []Option {
+	options := []Option{}
+	for _, m := range methods {
+		cents, ok := m.Provider.Rate(p)
+		if !ok {
+			continue
+		}
+		if m.FreeOverCents != nil && p.SubtotalCents >= *m.FreeOverCents {
+			cents = 0
+		}
+		options = append(options, Option{Code: m.Code, Name: m.Name, AmountCents: cents})
+	}
+
+	sort.SliceStable(options, func(i, j int) bool { return options[i].AmountCents < options[j].AmountCents })
+	return options
+}
@@ -0,0 +1,176 @@
+// Package tax computes sales tax and VAT for checkout from a table of rates
+// per country and region.
+package tax
+
+import "strings"
+
+// DefaultClass is the tax class of products that have not been given one.
+const DefaultClass = "standard"
+
+// Rate is one row of the rate table. A rate with an empty Region applies to
+// the whole country; region rates apply on top of it, so a country-wide GST
+// and a provincial PST are two rates.
+type Rate struct {
+	Name     string
+	Country  string
+	Region   string
+	TaxClass string
+	// BasisPoints is the rate in hundredths of a percent: 2000 is 20%.
+	BasisPoints int
+	// Inclusive rates are already part of the price and are extracted from
+	// it rather than added on top.
+	Inclusive bool
+	// Shipping makes the rate apply to the shipping charge as well.
+	Shipping bool
+}
+
+// Item is a taxable amount, after discounts, of the given tax class.
+type Item struct {
+	TaxClass    string
+	AmountCents int
+}
+
+type Request struct {
+	Country       string
+	Region        string
+	Items         []Item
+	ShippingCents int
+}
+
+// Line is the tax collected under one rate.
+type Line struct {
+	Name         string `json:"name"`
+	Country      string `json:"country"`
+	Region       string `json:"region,omitempty"`
+	BasisPoints  int    `json:"rate_bps"`
+	Inclusive    bool   `json:"inclusive"`
+	TaxableCents int    `json:"taxable_cents"`
+	AmountCents  int    `json:"amount_cents"`
+}
+
+type Result struct {
+	// ItemTaxCents holds the tax of each request item, in order.
+	ItemTaxCents     []int
+	ShippingTaxCents int
+	Lines            []Line
+	// TaxCents is all tax; ExclusiveCents is the part that is added to the
+	// total because it is not already included in the prices.
+	TaxCents       int
+	ExclusiveCents int
+}
+
+type TaxCalculator interface {
+	Calculate(req Request) (Result, error)
+}
+
+// Table is a TaxCalculator over a fixed list of rates.
+type Table struct {
+	Rates []Rate
+}
+
+func (t Table) Calculate(req Request) (Result, error) {
+	res := Result{ItemTaxCents: make([]int, len(req.Items)), Lines: []Line{}}
+	lines := map[int]*Line{}
+
+	add := func(i int, r Rate, taxable, amount int) {
+		l, ok := lines[i]
+		if !ok {
+			l = &Line{
+				Name: r.Name, Country: r.Country, Region: r.Region,
+				BasisPoints: r.BasisPoints, Inclusive: r.Inclusive,
+			}
+			lines[i] = l
+		}
+		l.TaxableCents += taxable
+		l.AmountCents += amount
+
+		res.TaxCents += amount
+		if !r.Inclusive {
+			res.ExclusiveCents += amount
+		}
+	}
+
+	tax := func(class string, amount int, shipping bool) int {
+		idx := t.matching(req.Country, req.Region, class, shipping)
+		if len(idx) == 0 || amount <= 0 {
+			return 0
+		}
+
+		// Inclusive rates are extracted together so that two of them do not
+		// each take their share of the other's tax; exclusive rates then
+		// apply to the net amount.
+		inclusiveBPS := 0
+		for _, i := range idx {
+			if t.Rates[i].Inclusive {
+				inclusiveBPS += t.Rates[i].BasisPoints
+			}
+		}
+
+		net := amount
+		total := 0
+		for _, i := range idx {
+			r := t.Rates[i]
+			if r.Inclusive {
+				cents := divRound(amount*r.BasisPoints, 10000+inclusiveBPS)
+				net -= cents
+				total += cents
+				add(i, r, amount, cents)
+			}
+		}
+		for _, i := range idx {
+			r := t.Rates[i]
+			if !r.Inclusive {
+				cents := divRound(net*r.BasisPoints, 10000)
+				total += cents
+				add(i, r, net, cents)
+			}
+		}
+		return total
+	}
+
+	for i, item := range req.Items {
+		class := item.TaxClass
+		if class == "" {
+			class = DefaultClass
+		}
+		res.ItemTaxCents[i] = tax(class, item.AmountCents, false)
+	}
+	res.ShippingTaxCents = tax(DefaultClass, req.ShippingCents, true)
+
+	for i := range t.Rates {
+		if l, ok := lines[i]; ok {
+			res.Lines = append(res.Lines, *l)
+		}
+	}
+	return res, nil
+}
+
+// matching returns the indexes of the rates for the destination and class.
+// Shipping is taxed by the standard rates that have Shipping set.
+func (t Table) matching(country, region, class string, shipping bool) []int {
+	country = strings.ToUpper(country)
+	region = strings.ToUpper(region)
+
+	idx := []int{}
+	for i, r := range t.Rates {
+		if r.Country != country || r.TaxClass != class {
+			continue
+		}
+		if r.Region != "" && r.Region != region {
+			continue
+		}
+		if shipping && !r.Shipping {
+			continue
+		}
+		idx = append(idx, i)
+	}
+	return idx
+}
+
+// divRound divides rounding half away from zero.
+func divRound(a, b int) int {
+	if a < 0 {
+		return -divRound(-a, b)
+	}
+	return (a + b/2) / b
+}
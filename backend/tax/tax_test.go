@@ -0,0 +1,213 @@
+package tax
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTableCalculate(t *testing.T) {
+	vat := Rate{Name: "VAT", Country: "GB", TaxClass: DefaultClass, BasisPoints: 2000, Inclusive: true, Shipping: true}
+	gst := Rate{Name: "GST", Country: "CA", TaxClass: DefaultClass, BasisPoints: 500, Shipping: true}
+	pst := Rate{Name: "PST", Country: "CA", Region: "BC", TaxClass: DefaultClass, BasisPoints: 700}
+
+	tests := []struct {
+		name          string
+		rates         []Rate
+		req           Request
+		wantItems     []int
+		wantShipping  int
+		wantTax       int
+		wantExclusive int
+	}{
+		{
+			name:      "no matching rate",
+			rates:     []Rate{gst},
+			req:       Request{Country: "US", Items: []Item{{AmountCents: 1000}}},
+			wantItems: []int{0},
+		},
+		{
+			name:          "exclusive rate is added",
+			rates:         []Rate{gst},
+			req:           Request{Country: "CA", Items: []Item{{AmountCents: 1000}}},
+			wantItems:     []int{50},
+			wantTax:       50,
+			wantExclusive: 50,
+		},
+		{
+			name:      "inclusive rate is extracted",
+			rates:     []Rate{vat},
+			req:       Request{Country: "GB", Items: []Item{{AmountCents: 1200}}},
+			wantItems: []int{200},
+			wantTax:   200,
+		},
+		{
+			name:          "region rate stacks on the country rate",
+			rates:         []Rate{gst, pst},
+			req:           Request{Country: "CA", Region: "BC", Items: []Item{{AmountCents: 1000}}},
+			wantItems:     []int{120},
+			wantTax:       120,
+			wantExclusive: 120,
+		},
+		{
+			name:          "region rate of another region is ignored",
+			rates:         []Rate{gst, pst},
+			req:           Request{Country: "CA", Region: "ON", Items: []Item{{AmountCents: 1000}}},
+			wantItems:     []int{50},
+			wantTax:       50,
+			wantExclusive: 50,
+		},
+		{
+			name:          "country and region are matched case-insensitively",
+			rates:         []Rate{gst, pst},
+			req:           Request{Country: "ca", Region: "bc", Items: []Item{{AmountCents: 1000}}},
+			wantItems:     []int{120},
+			wantTax:       120,
+			wantExclusive: 120,
+		},
+		{
+			name: "inclusive rates are extracted together",
+			rates: []Rate{
+				{Name: "A", Country: "XX", TaxClass: DefaultClass, BasisPoints: 1000, Inclusive: true},
+				{Name: "B", Country: "XX", TaxClass: DefaultClass, BasisPoints: 1000, Inclusive: true},
+			},
+			req:       Request{Country: "XX", Items: []Item{{AmountCents: 1200}}},
+			wantItems: []int{200},
+			wantTax:   200,
+		},
+		{
+			name: "exclusive rate applies to the net of an inclusive one",
+			rates: []Rate{
+				{Name: "A", Country: "XX", TaxClass: DefaultClass, BasisPoints: 2000, Inclusive: true},
+				{Name: "B", Country: "XX", TaxClass: DefaultClass, BasisPoints: 500},
+			},
+			req:           Request{Country: "XX", Items: []Item{{AmountCents: 1200}}},
+			wantItems:     []int{250},
+			wantTax:       250,
+			wantExclusive: 50,
+		},
+		{
+			name:          "shipping is taxed only by shipping rates",
+			rates:         []Rate{gst, pst},
+			req:           Request{Country: "CA", Region: "BC", ShippingCents: 500},
+			wantItems:     []int{},
+			wantShipping:  25,
+			wantTax:       25,
+			wantExclusive: 25,
+		},
+		{
+			name:         "inclusive shipping tax",
+			rates:        []Rate{vat},
+			req:          Request{Country: "GB", Items: []Item{{AmountCents: 600}}, ShippingCents: 600},
+			wantItems:    []int{100},
+			wantShipping: 100,
+			wantTax:      200,
+		},
+		{
+			name:  "other tax classes are not taxed by standard rates",
+			rates: []Rate{gst, {Name: "Reduced", Country: "CA", TaxClass: "reduced", BasisPoints: 100}},
+			req: Request{Country: "CA", Items: []Item{
+				{TaxClass: "reduced", AmountCents: 1000},
+				{TaxClass: "zero", AmountCents: 1000},
+				{AmountCents: 1000},
+			}},
+			wantItems:     []int{10, 0, 50},
+			wantTax:       60,
+			wantExclusive: 60,
+		},
+		{
+			name:          "exclusive tax rounds half up",
+			rates:         []Rate{{Name: "A", Country: "XX", TaxClass: DefaultClass, BasisPoints: 1000}},
+			req:           Request{Country: "XX", Items: []Item{{AmountCents: 5}, {AmountCents: 4}}},
+			wantItems:     []int{1, 0},
+			wantTax:       1,
+			wantExclusive: 1,
+		},
+		{
+			name:      "inclusive tax rounds half up",
+			rates:     []Rate{vat},
+			req:       Request{Country: "GB", Items: []Item{{AmountCents: 999}}},
+			wantItems: []int{167},
+			wantTax:   167,
+		},
+		{
+			name:      "non-positive amounts are not taxed",
+			rates:     []Rate{gst},
+			req:       Request{Country: "CA", Items: []Item{{AmountCents: 0}, {AmountCents: -100}}},
+			wantItems: []int{0, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := Table{Rates: tt.rates}.Calculate(tt.req)
+			if err != nil {
+				t.Fatalf("Calculate: %v", err)
+			}
+			if !reflect.DeepEqual(res.ItemTaxCents, tt.wantItems) {
+				t.Errorf("ItemTaxCents = %v, want %v", res.ItemTaxCents, tt.wantItems)
+			}
+			if res.ShippingTaxCents != tt.wantShipping {
+				t.Errorf("ShippingTaxCents = %d, want %d", res.ShippingTaxCents, tt.wantShipping)
+			}
+			if res.TaxCents != tt.wantTax {
+				t.Errorf("TaxCents = %d, want %d", res.TaxCents, tt.wantTax)
+			}
+			if res.ExclusiveCents != tt.wantExclusive {
+				t.Errorf("ExclusiveCents = %d, want %d", res.ExclusiveCents, tt.wantExclusive)
+			}
+
+			sum := 0
+			for _, l := range res.Lines {
+				sum += l.AmountCents
+			}
+			if sum != res.TaxCents {
+				t.Errorf("lines add up to %d, want %d", sum, res.TaxCents)
+			}
+		})
+	}
+}
+
+func TestTableCalculateLines(t *testing.T) {
+	table := Table{Rates: []Rate{
+		{Name: "GST", Country: "CA", TaxClass: DefaultClass, BasisPoints: 500, Shipping: true},
+		{Name: "PST", Country: "CA", Region: "BC", TaxClass: DefaultClass, BasisPoints: 700},
+	}}
+
+	res, err := table.Calculate(Request{
+		Country:       "CA",
+		Region:        "BC",
+		Items:         []Item{{AmountCents: 1000}, {AmountCents: 2000}},
+		ShippingCents: 500,
+	})
+	if err != nil {
+		t.Fatalf("Calculate: %v", err)
+	}
+
+	want := []Line{
+		{Name: "GST", Country: "CA", BasisPoints: 500, TaxableCents: 3500, AmountCents: 175},
+		{Name: "PST", Country: "CA", Region: "BC", BasisPoints: 700, TaxableCents: 3000, AmountCents: 210},
+	}
+	if !reflect.DeepEqual(res.Lines, want) {
+		t.Errorf("Lines = %+v, want %+v", res.Lines, want)
+	}
+}
+
+func TestDivRound(t *testing.T) {
+	tests := []struct {
+		a, b, want int
+	}{
+		{0, 10, 0},
+		{4, 10, 0},
+		{5, 10, 1},
+		{6, 10, 1},
+		{15, 10, 2},
+		{-4, 10, 0},
+		{-5, 10, -1},
+		{-15, 10, -2},
+	}
+	for _, tt := range tests {
+		if got := divRound(tt.a, tt.b); got != tt.want {
+			t.Errorf("divRound(%d, %d) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}